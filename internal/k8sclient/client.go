@@ -2,6 +2,7 @@ package k8sclient
 
 import (
 	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 )
@@ -14,3 +15,13 @@ func NewClient(kubeconfigPath string) (*kubernetes.Clientset, error) {
 	logrus.Infof("Kubernetes client created")
 	return kubernetes.NewForConfig(config)
 }
+
+// NewDynamicClient 用于按清单提交任意类型的资源，如回滚Helm Release
+func NewDynamicClient(kubeconfigPath string) (dynamic.Interface, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("Kubernetes dynamic client created")
+	return dynamic.NewForConfig(config)
+}
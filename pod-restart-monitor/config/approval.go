@@ -0,0 +1,64 @@
+package config
+
+import (
+	"github.com/sirupsen/logrus"
+	"os"
+	"strings"
+	"time"
+)
+
+// 审批动作
+const (
+	ApprovalApprove = "approve"
+	ApprovalReject  = "reject"
+	ApprovalSnooze  = "snooze"
+)
+
+// ApprovalConfig 人工审批回滚的配置
+type ApprovalConfig struct {
+	ListenAddr        string        // 审批回调HTTP服务的监听地址，为空表示不启动
+	CallbackURL       string        // 回调服务的外部访问地址，用于生成企业微信审批链接
+	Secret            string        // 企业微信审批链接的HMAC签名密钥
+	LarkEncryptKey    string        // 飞书卡片回调的Encrypt Key，用于校验签名与解密
+	LarkVerifyToken   string        // 飞书卡片回调的Verification Token
+	Timeout           time.Duration // 超时未处理时执行默认动作
+	DefaultAction     string        // approve/reject
+	SnoozeDuration    time.Duration // 稍后处理的延后时间，到期后重新发起审批
+	SignatureValidity time.Duration // 回调请求时间戳的有效期
+}
+
+func parseApproval(rollback string) ApprovalConfig {
+	listenAddr := strings.TrimSpace(os.Getenv("APPROVAL_LISTEN_ADDR"))
+	if listenAddr == "" && rollback == RollbackModeApproval {
+		listenAddr = ":8080"
+	}
+
+	approval := ApprovalConfig{
+		ListenAddr:        listenAddr,
+		CallbackURL:       strings.TrimRight(strings.TrimSpace(os.Getenv("APPROVAL_CALLBACK_URL")), "/"),
+		Secret:            os.Getenv("APPROVAL_SECRET"),
+		LarkEncryptKey:    os.Getenv("APPROVAL_LARK_ENCRYPT_KEY"),
+		LarkVerifyToken:   os.Getenv("APPROVAL_LARK_VERIFICATION_TOKEN"),
+		Timeout:           parsePositiveDuration(os.Getenv("APPROVAL_TIMEOUT"), 30*time.Minute),
+		DefaultAction:     parseApprovalDefaultAction(os.Getenv("APPROVAL_DEFAULT_ACTION")),
+		SnoozeDuration:    parsePositiveDuration(os.Getenv("APPROVAL_SNOOZE"), time.Hour),
+		SignatureValidity: 5 * time.Minute,
+	}
+	if approval.ListenAddr != "" && approval.Secret == "" && approval.LarkEncryptKey == "" {
+		logrus.Warn("Approval server enabled without APPROVAL_SECRET or APPROVAL_LARK_ENCRYPT_KEY, all callbacks will be rejected")
+	}
+	return approval
+}
+
+// 超时默认动作，不填写默认拒绝回滚
+func parseApprovalDefaultAction(input string) string {
+	switch strings.ToLower(strings.TrimSpace(input)) {
+	case ApprovalApprove:
+		return ApprovalApprove
+	case "", ApprovalReject:
+		return ApprovalReject
+	default:
+		logrus.WithField("action", input).Warn("Invalid approval default action, using reject")
+		return ApprovalReject
+	}
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+)
+
+// CausePattern 通过日志特征识别崩溃原因的规则
+type CausePattern struct {
+	Name     string
+	Category string
+	Regexp   *regexp.Regexp
+}
+
+// 内置的日志特征库，格式同 CAUSE_PATTERNS
+var defaultCausePatterns = []string{
+	`go-panic|application|panic: .*|goroutine \d+ \[running\]`,
+	`java-out-of-memory|resource|java\.lang\.OutOfMemoryError[^\n]*`,
+	`dependency-unreachable|dependency|(?i)(connection refused|econnrefused|no such host|connection timed out|i/o timeout)[^\n]*`,
+	`missing-env|config|(?i)(environment variable|env var)[^\n]*(not set|missing|required|undefined)[^\n]*`,
+	`missing-env|config|KeyError: '[A-Z0-9_]+'`,
+	`volume-permission-denied|permission|(?i)(permission denied|operation not permitted|read-only file system)[^\n]*`,
+	`python-exception|application|Traceback \(most recent call last\)`,
+	`java-exception|application|Exception in thread "[^"]*" [^\n]*`,
+}
+
+// 解析日志特征库，每行一条 "名称|分类|正则"，用户规则优先于内置规则匹配
+func parseCausePatterns(input string) []CausePattern {
+	var lines []string
+	for _, line := range strings.Split(input, "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			lines = append(lines, trimmed)
+		}
+	}
+	lines = append(lines, defaultCausePatterns...)
+
+	var result []CausePattern
+	for _, line := range lines {
+		parts := strings.SplitN(line, "|", 3)
+		if len(parts) != 3 {
+			logrus.WithField("pattern", line).Warn("Invalid cause pattern, expected name|category|regex")
+			continue
+		}
+		compiled, err := regexp.Compile(parts[2])
+		if err != nil {
+			logrus.WithField("pattern", line).WithError(err).Warn("Invalid cause pattern, ignored")
+			continue
+		}
+		result = append(result, CausePattern{
+			Name:     strings.TrimSpace(parts[0]),
+			Category: strings.TrimSpace(parts[1]),
+			Regexp:   compiled,
+		})
+	}
+	return result
+}
+
+// 解析跳过回滚的原因列表，不填写默认下游依赖故障时不回滚
+func parseRollbackSkipCauses(input string) []string {
+	if input == "" {
+		return []string{"dependency"}
+	}
+	if strings.TrimSpace(input) == "none" {
+		return nil
+	}
+	return parseList(input)
+}
@@ -1,21 +1,67 @@
 package config
 
 import (
+	"github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// 回滚模式
+const (
+	RollbackModeOff      = "off"
+	RollbackModeOn       = "on"
+	RollbackModeDryRun   = "dry-run"  // 完整走决策流程并在服务端演练回滚，不做实际修改
+	RollbackModeApproval = "approval" // 发送审批卡片，人工批准后回滚
+)
+
+// NotifyChannel 具名通知渠道，可通过 podsentry.io/notify-channel 注解引用
+type NotifyChannel struct {
+	Type    string
+	Webhook string
+}
+
 type Config struct {
 	KubeconfigPath string
 	Namespaces     []string
-	TimeWindow     time.Duration
-	Threshold      int
-	NotifyType     string
-	Webhook        string
-	Rollback       bool
+	// 命名空间标签选择器与排除列表，任一非空时根据命名空间变化动态启停监听
+	NamespaceSelector  string
+	ExcludeNamespaces  []string
+	TimeWindow         time.Duration
+	Threshold          int
+	CrashLoopReplicas  int
+	CrashLoopNodes     int
+	ContainerInclude   []string
+	ContainerExclude   []string
+	NotifyType         string
+	Webhook            string
+	NotifyChannels     map[string]NotifyChannel
+	Rollback           string // off/on/dry-run/approval
+	RolloutTimeout     time.Duration
+	StablePeriod       time.Duration // Deployment版本稳定运行多久后记录为最近稳定版本，0表示不记录
+	RollbackLimits     RollbackLimits
+	Guardrails         Guardrails
+	HelmRollback       string // Helm管理的工作负载的回滚方式 notify/release
+	GitOpsStrategy     string // GitOps管理的工作负载的回滚方式 notify/suspend/argocd-rollback
+	ArgoCDNamespace    string
+	Remediation        string // 达到阈值后的处置动作，由 Rollback 模式控制是否执行
+	CronJobSuspend     int    // CronJob连续失败多少次后暂停，0表示不暂停
+	Ladder             []LadderStep
+	LadderGrace        time.Duration // 升级阶梯两步之间的观察期
+	LadderReset        time.Duration // 不再重启多久后升级阶梯从第一步重新开始
+	Approval           ApprovalConfig
+	ResyncPeriod       time.Duration
+	Detectors          map[string]DetectorConfig
+	PendingTimeout     time.Duration
+	EventReasons       []string
+	LogTailLines       int
+	LogTailBytes       int
+	LogRedactPatterns  []*regexp.Regexp
+	CausePatterns      []CausePattern
+	RollbackSkipCauses []string
 }
 
 func LoadConfig() *Config {
@@ -23,18 +69,75 @@ func LoadConfig() *Config {
 	kubeconfig := os.Getenv("KUBECONFIG_PATH")
 	timeWindow := os.Getenv("TIME_WINDOW")
 	threshold := os.Getenv("THRESHOLD")
+	crashLoopReplicas := os.Getenv("CRASHLOOP_REPLICAS")
+	crashLoopNodes := os.Getenv("DAEMONSET_NODE_THRESHOLD")
+	containerInclude := os.Getenv("CONTAINER_INCLUDE")
+	containerExclude := os.Getenv("CONTAINER_EXCLUDE")
 	notifyType := os.Getenv("NOTIFY_TYPE")
 	webhook := os.Getenv("WEBHOOK")
 	rollback := os.Getenv("ROLLBACK")
+	rolloutTimeout := os.Getenv("ROLLOUT_VERIFY_TIMEOUT")
+	stablePeriod := os.Getenv("STABLE_PERIOD")
+	resyncPeriod := os.Getenv("RESYNC_PERIOD")
+	namespaceSelector := os.Getenv("NAMESPACE_SELECTOR")
+	excludeNamespaces := os.Getenv("EXCLUDE_NAMESPACES")
+	notifyChannels := os.Getenv("NOTIFY_CHANNELS")
+	detectors := os.Getenv("DETECTORS")
+	pendingTimeout := os.Getenv("PENDING_TIMEOUT")
+	eventReasons := os.Getenv("EVENT_REASONS")
+	logTailLines := os.Getenv("LOG_TAIL_LINES")
+	logTailBytes := os.Getenv("LOG_TAIL_BYTES")
+	logRedactPatterns := os.Getenv("LOG_REDACT_PATTERNS")
+	causePatterns := os.Getenv("CAUSE_PATTERNS")
+	rollbackSkipCauses := os.Getenv("ROLLBACK_SKIP_CAUSES")
+	remediation := os.Getenv("REMEDIATION")
+	cronJobSuspend := os.Getenv("CRONJOB_SUSPEND_AFTER")
+	helmRollback := os.Getenv("HELM_ROLLBACK")
+	gitOpsStrategy := os.Getenv("GITOPS_STRATEGY")
+	argoCDNamespace := os.Getenv("ARGOCD_NAMESPACE")
+	ladder := os.Getenv("LADDER")
+	ladderGrace := os.Getenv("LADDER_GRACE")
+	ladderReset := os.Getenv("LADDER_RESET")
+	// 审批服务是否启动取决于回滚模式
+	rollbackMode := parseRollback(rollback)
 
 	return &Config{
-		KubeconfigPath: parseKubeconfig(kubeconfig),
-		Namespaces:     parseNamespaces(namespace),
-		TimeWindow:     parseTimeWindow(timeWindow),
-		Threshold:      parseThreshold(threshold),
-		NotifyType:     parseNotifyType(notifyType),
-		Webhook:        parseWebhook(notifyType, webhook),
-		Rollback:       parseRollback(rollback),
+		KubeconfigPath:     parseKubeconfig(kubeconfig),
+		Namespaces:         parseNamespaces(namespace),
+		NamespaceSelector:  strings.TrimSpace(namespaceSelector),
+		ExcludeNamespaces:  parseList(excludeNamespaces),
+		TimeWindow:         parseTimeWindow(timeWindow),
+		Threshold:          parseThreshold(threshold),
+		CrashLoopReplicas:  parseCrashLoopReplicas(crashLoopReplicas),
+		CrashLoopNodes:     parseNonNegativeInt(crashLoopNodes, 0),
+		ContainerInclude:   parseList(containerInclude),
+		ContainerExclude:   parseList(containerExclude),
+		NotifyType:         parseNotifyType(notifyType),
+		Webhook:            parseWebhook(notifyType, webhook),
+		NotifyChannels:     parseNotifyChannels(notifyChannels),
+		Rollback:           rollbackMode,
+		RolloutTimeout:     parseRolloutTimeout(rolloutTimeout),
+		StablePeriod:       parseNonNegativeDuration(stablePeriod, 10*time.Minute),
+		RollbackLimits:     parseRollbackLimits(),
+		Guardrails:         parseGuardrails(),
+		HelmRollback:       parseHelmRollback(helmRollback),
+		GitOpsStrategy:     parseGitOpsStrategy(gitOpsStrategy),
+		ArgoCDNamespace:    parseArgoCDNamespace(argoCDNamespace),
+		Remediation:        parseRemediation(remediation),
+		CronJobSuspend:     parseNonNegativeInt(cronJobSuspend, 0),
+		Ladder:             parseLadder(ladder),
+		LadderGrace:        parsePositiveDuration(ladderGrace, 5*time.Minute),
+		LadderReset:        parsePositiveDuration(ladderReset, time.Hour),
+		Approval:           parseApproval(rollbackMode),
+		ResyncPeriod:       parseResyncPeriod(resyncPeriod),
+		Detectors:          parseDetectors(detectors),
+		PendingTimeout:     parsePendingTimeout(pendingTimeout),
+		EventReasons:       parseEventReasons(eventReasons),
+		LogTailLines:       parseNonNegativeInt(logTailLines, 20),
+		LogTailBytes:       parseNonNegativeInt(logTailBytes, 4096),
+		LogRedactPatterns:  parseRedactPatterns(logRedactPatterns),
+		CausePatterns:      parseCausePatterns(causePatterns),
+		RollbackSkipCauses: parseRollbackSkipCauses(rollbackSkipCauses),
 	}
 }
 
@@ -63,6 +166,62 @@ func parseNamespaces(input string) []string {
 	return result
 }
 
+// 解析逗号分隔的列表，忽略空项
+func parseList(input string) []string {
+	var result []string
+	for _, p := range strings.Split(input, ",") {
+		if trimmed := strings.TrimSpace(p); trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+	return result
+}
+
+// 需要关联到Pod记录的事件原因，不填写使用默认列表
+func parseEventReasons(input string) []string {
+	if reasons := parseList(input); len(reasons) > 0 {
+		return reasons
+	}
+	return []string{"BackOff", "Unhealthy", "Killing", "FailedScheduling", "FailedMount"}
+}
+
+// 解析非负整数，为空或非法时返回默认值
+func parseNonNegativeInt(input string, defaultValue int) int {
+	value, err := strconv.Atoi(strings.TrimSpace(input))
+	if err != nil || value < 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// 默认的日志脱敏规则：口令/令牌类键值对与Authorization头
+var defaultRedactPatterns = []string{
+	`(?i)((?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key)["']?\s*[:=]\s*["']?)[^\s"',;]+`,
+	`(?i)(authorization["']?\s*[:=]\s*["']?(?:bearer|basic)\s+)\S+`,
+	`(?i)(bearer\s+)[a-z0-9\-._~+/]+=*`,
+}
+
+// 解析日志脱敏正则，每行一个，追加在默认规则之后；非法正则记录日志并忽略
+func parseRedactPatterns(input string) []*regexp.Regexp {
+	patterns := append([]string(nil), defaultRedactPatterns...)
+	for _, line := range strings.Split(input, "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			patterns = append(patterns, trimmed)
+		}
+	}
+
+	var result []*regexp.Regexp
+	for _, pattern := range patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			logrus.WithField("pattern", pattern).WithError(err).Warn("Invalid log redact pattern, ignored")
+			continue
+		}
+		result = append(result, compiled)
+	}
+	return result
+}
+
 func parseThreshold(input string) int {
 	if input == "" {
 		return 3
@@ -76,6 +235,14 @@ func parseThreshold(input string) int {
 	return value
 }
 
+func parseCrashLoopReplicas(input string) int {
+	value, err := strconv.Atoi(strings.TrimSpace(input))
+	if err != nil || value < 0 {
+		return 0
+	}
+	return value
+}
+
 func parseTimeWindow(input string) time.Duration {
 	cleaned := strings.TrimSpace(input)
 	if cleaned == "" {
@@ -105,15 +272,74 @@ func parseWebhook(notifyType string, input string) string {
 	}
 }
 
-func parseRollback(input string) bool {
-	if input == "" {
-		return false
+// 解析具名通知渠道，格式: name=type|webhook;name2=type|webhook
+func parseNotifyChannels(input string) map[string]NotifyChannel {
+	result := make(map[string]NotifyChannel)
+	for _, entry := range strings.Split(input, ";") {
+		name, value, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found {
+			continue
+		}
+		notifyType, webhook, found := strings.Cut(value, "|")
+		if !found {
+			continue
+		}
+		notifyType = parseNotifyType(strings.TrimSpace(notifyType))
+		result[strings.TrimSpace(name)] = NotifyChannel{
+			Type:    notifyType,
+			Webhook: parseWebhook(notifyType, webhook),
+		}
+	}
+	return result
+}
+
+// 解析回滚模式，true/false 兼容旧配置，dry-run 只演练不修改，approval 人工审批后回滚
+func parseRollback(input string) string {
+	mode, ok := ParseRollbackMode(input)
+	if !ok {
+		logrus.WithField("rollback", input).Warn("Invalid rollback mode, rollback disabled")
+	}
+	return mode
+}
+
+// ParseRollbackMode 解析回滚模式，供环境变量与注解共用
+func ParseRollbackMode(input string) (string, bool) {
+	cleaned := strings.ToLower(strings.TrimSpace(input))
+	if cleaned == "" {
+		return RollbackModeOff, true
+	}
+	if cleaned == RollbackModeDryRun || cleaned == RollbackModeApproval {
+		return cleaned, true
 	}
 
-	value, err := (strconv.ParseBool(strings.ToLower(input)))
+	value, err := strconv.ParseBool(cleaned)
 	if err != nil {
-		return false
+		return RollbackModeOff, false
+	}
+	if value {
+		return RollbackModeOn, true
 	}
+	return RollbackModeOff, true
+}
 
-	return value
+// 回滚后等待滚动完成的超时时间，超时未完成则升级告警
+func parseRolloutTimeout(input string) time.Duration {
+	duration, err := time.ParseDuration(strings.TrimSpace(input))
+	if err != nil || duration <= 0 {
+		return 10 * time.Minute
+	}
+	return duration
+}
+
+func parseResyncPeriod(input string) time.Duration {
+	cleaned := strings.TrimSpace(input)
+	if cleaned == "" {
+		return 10 * time.Minute
+	}
+
+	duration, err := time.ParseDuration(cleaned)
+	if err != nil || duration < 0 {
+		return 10 * time.Minute
+	}
+	return duration
 }
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 检测器名称
+const (
+	DetectorOOMKilled                  = "oomkilled"
+	DetectorImagePull                  = "imagepull"
+	DetectorCreateContainerConfigError = "createcontainerconfigerror"
+	DetectorRunContainerError          = "runcontainererror"
+	DetectorEvicted                    = "evicted"
+	DetectorPending                    = "pending"
+)
+
+// 告警级别
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// DetectorConfig 单个检测器的配置
+type DetectorConfig struct {
+	Enabled   bool
+	Threshold int    // 时间窗口内同一工作负载检测到的次数阈值
+	Severity  string // info/warning/critical
+	Template  string // text/template格式的告警内容
+}
+
+// 各检测器的默认配置
+func defaultDetectors() map[string]DetectorConfig {
+	return map[string]DetectorConfig{
+		DetectorOOMKilled: {
+			Threshold: 1,
+			Severity:  SeverityCritical,
+			Template:  "container {{.Container}} was OOMKilled {{.Count}} times within {{.TimeWindow}}",
+		},
+		DetectorImagePull: {
+			Threshold: 1,
+			Severity:  SeverityCritical,
+			Template:  "container {{.Container}} cannot pull image: {{.Detail}}",
+		},
+		DetectorCreateContainerConfigError: {
+			Threshold: 1,
+			Severity:  SeverityCritical,
+			Template:  "container {{.Container}} has invalid config: {{.Detail}}",
+		},
+		DetectorRunContainerError: {
+			Threshold: 1,
+			Severity:  SeverityCritical,
+			Template:  "container {{.Container}} failed to start: {{.Detail}}",
+		},
+		DetectorEvicted: {
+			Threshold: 1,
+			Severity:  SeverityWarning,
+			Template:  "{{.Count}} pods evicted within {{.TimeWindow}}, last: {{.Detail}}",
+		},
+		DetectorPending: {
+			Threshold: 1,
+			Severity:  SeverityWarning,
+			Template:  "pod {{.Pod}} pending longer than {{.PendingTimeout}}: {{.Detail}}",
+		},
+	}
+}
+
+// 解析检测器配置
+// DETECTORS 为启用的检测器列表，为空表示全部启用；
+// DETECTOR_<NAME>_THRESHOLD / _SEVERITY / _TEMPLATE 覆盖单个检测器的默认配置
+func parseDetectors(enabled string) map[string]DetectorConfig {
+	detectors := defaultDetectors()
+	enabledSet := make(map[string]bool)
+	for _, name := range parseList(strings.ToLower(enabled)) {
+		enabledSet[name] = true
+	}
+
+	for name, detector := range detectors {
+		detector.Enabled = len(enabledSet) == 0 || enabledSet[name]
+
+		prefix := "DETECTOR_" + strings.ToUpper(name) + "_"
+		if value, err := strconv.Atoi(strings.TrimSpace(os.Getenv(prefix + "THRESHOLD"))); err == nil && value > 0 {
+			detector.Threshold = value
+		}
+		switch severity := strings.ToLower(strings.TrimSpace(os.Getenv(prefix + "SEVERITY"))); severity {
+		case SeverityInfo, SeverityWarning, SeverityCritical:
+			detector.Severity = severity
+		}
+		if template := strings.TrimSpace(os.Getenv(prefix + "TEMPLATE")); template != "" {
+			detector.Template = template
+		}
+		detectors[name] = detector
+	}
+	return detectors
+}
+
+func parsePendingTimeout(input string) time.Duration {
+	duration, err := time.ParseDuration(strings.TrimSpace(input))
+	if err != nil || duration <= 0 {
+		return 10 * time.Minute
+	}
+	return duration
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FreezeWindow 冻结窗口: 按cron表达式开始，持续Duration，期间不执行任何自动处置
+type FreezeWindow struct {
+	Spec     string // 原始配置，用于通知
+	Duration time.Duration
+	minute   cronField
+	hour     cronField
+	dom      cronField
+	month    cronField
+	dow      cronField
+}
+
+// cronField 字段允许的取值，按位表示
+type cronField struct {
+	bits uint64
+	any  bool // 字段为 *，日与星期同时受限时按标准cron取并集
+}
+
+func (f cronField) has(value int) bool {
+	return f.bits&(1<<uint(value)) != 0
+}
+
+// ParseFreezeWindow 解析冻结窗口，格式为 "分 时 日 月 星期 持续时长"，如 "0 18 * * 5 64h" 表示周五18点起冻结64小时
+// 支持 *、数字、a-b 范围、逗号列表与 /n 步长，星期0与7都表示周日
+func ParseFreezeWindow(input string) (FreezeWindow, error) {
+	fields := strings.Fields(input)
+	if len(fields) != 6 {
+		return FreezeWindow{}, fmt.Errorf("invalid freeze window %q, expected 5 cron fields and a duration", input)
+	}
+	duration, err := time.ParseDuration(fields[5])
+	if err != nil || duration <= 0 {
+		return FreezeWindow{}, fmt.Errorf("invalid duration in freeze window %q", input)
+	}
+
+	window := FreezeWindow{Spec: strings.Join(fields, " "), Duration: duration}
+	bounds := []struct {
+		field    *cronField
+		min, max int
+	}{
+		{&window.minute, 0, 59},
+		{&window.hour, 0, 23},
+		{&window.dom, 1, 31},
+		{&window.month, 1, 12},
+		{&window.dow, 0, 7},
+	}
+	for i, b := range bounds {
+		if *b.field, err = parseCronField(fields[i], b.min, b.max); err != nil {
+			return FreezeWindow{}, fmt.Errorf("freeze window %q: %w", input, err)
+		}
+	}
+	if window.dow.has(7) {
+		window.dow.bits |= 1
+	}
+	return window, nil
+}
+
+func parseCronField(input string, min, max int) (cronField, error) {
+	var field cronField
+	for _, part := range strings.Split(input, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return cronField{}, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart = part[:i]
+		}
+
+		low, high := min, max
+		switch {
+		case rangePart == "*":
+			field.any = field.any || step == 1
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err1, err2 error
+			low, err1 = strconv.Atoi(bounds[0])
+			high, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return cronField{}, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			value, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return cronField{}, fmt.Errorf("invalid value %q", part)
+			}
+			low = value
+			// 与cron一致，"5/10" 表示从5开始到最大值
+			if step == 1 {
+				high = value
+			}
+		}
+		if low < min || high > max || low > high {
+			return cronField{}, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+		for value := low; value <= high; value += step {
+			field.bits |= 1 << uint(value)
+		}
+	}
+	return field, nil
+}
+
+// 某一天是否匹配，日与星期都受限时满足其一即可
+func (w FreezeWindow) matchesDay(t time.Time) bool {
+	if !w.month.has(int(t.Month())) {
+		return false
+	}
+	dom, dow := w.dom.has(t.Day()), w.dow.has(int(t.Weekday()))
+	switch {
+	case w.dom.any && w.dow.any:
+		return true
+	case w.dom.any:
+		return dow
+	case w.dow.any:
+		return dom
+	}
+	return dom || dow
+}
+
+// Active 窗口是否覆盖now，返回本次冻结的结束时间；从now向前查找持续时长内最近一次触发时间，不匹配的日期与小时整体跳过
+func (w FreezeWindow) Active(now time.Time) (time.Time, bool) {
+	earliest := now.Add(-w.Duration)
+	for t := now.Truncate(time.Minute); t.After(earliest); {
+		switch {
+		case !w.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+		case !w.hour.has(t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location()).Add(-time.Minute)
+		case !w.minute.has(t.Minute()):
+			t = t.Add(-time.Minute)
+		default:
+			return t.Add(w.Duration), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// 解析冻结窗口列表，分号分隔；非法的窗口记录日志并忽略
+func parseFreezeWindows(input string) []FreezeWindow {
+	var windows []FreezeWindow
+	for _, item := range strings.Split(input, ";") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		window, err := ParseFreezeWindow(item)
+		if err != nil {
+			logrus.WithField("freezeWindow", item).WithError(err).Warn("Invalid freeze window, ignored")
+			continue
+		}
+		windows = append(windows, window)
+	}
+	return windows
+}
+
+// Guardrails 所有自动处置（回滚、处置动作、暂停CronJob等）的全局开关
+type Guardrails struct {
+	Namespaces          []string // 允许自动处置的命名空间，支持通配符，为空表示不限制
+	ExcludeNamespaces   []string // 禁止自动处置的命名空间，优先于允许列表
+	FreezeWindows       []FreezeWindow
+	KillSwitchNamespace string // kill switch ConfigMap，为空表示不启用
+	KillSwitchName      string
+}
+
+func parseGuardrails() Guardrails {
+	guardrails := Guardrails{
+		Namespaces:        parseList(os.Getenv("ROLLBACK_NAMESPACES")),
+		ExcludeNamespaces: parseList(os.Getenv("ROLLBACK_EXCLUDE_NAMESPACES")),
+		FreezeWindows:     parseFreezeWindows(os.Getenv("FREEZE_WINDOWS")),
+	}
+	// 格式为 命名空间/名称，配置错误时拒绝启动，避免误以为kill switch已生效
+	if killSwitch := strings.TrimSpace(os.Getenv("KILL_SWITCH_CONFIGMAP")); killSwitch != "" {
+		parts := strings.SplitN(killSwitch, "/", 2)
+		if len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+			guardrails.KillSwitchNamespace, guardrails.KillSwitchName = parts[0], parts[1]
+		} else {
+			logrus.WithField("killSwitch", killSwitch).Fatal("Invalid kill switch configmap, expected namespace/name")
+		}
+	}
+	return guardrails
+}
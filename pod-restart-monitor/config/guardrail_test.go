@@ -0,0 +1,68 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFreezeWindowInvalid(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"0 18 * * 5",
+		"0 18 * * 5 forever",
+		"0 18 * * 5 -1h",
+		"60 18 * * 5 1h",
+		"0 24 * * * 1h",
+		"0 18 0 * * 1h",
+		"0 18 * 13 * 1h",
+		"0 18 * * 8 1h",
+		"0 18-9 * * * 1h",
+		"*/0 * * * * 1h",
+		"a * * * * 1h",
+	} {
+		if _, err := ParseFreezeWindow(input); err == nil {
+			t.Errorf("ParseFreezeWindow(%q) expected error", input)
+		}
+	}
+}
+
+func TestFreezeWindowActive(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		spec    string
+		now     time.Time
+		active  bool
+		wantEnd time.Time
+	}{
+		// 2026-10-16 为周五，周五18点起冻结64小时到周一10点
+		{spec: "0 18 * * 5 64h", now: at(16, 17, 59), active: false},
+		{spec: "0 18 * * 5 64h", now: at(16, 18, 0), active: true, wantEnd: at(19, 10, 0)},
+		{spec: "0 18 * * 5 64h", now: at(18, 12, 30), active: true, wantEnd: at(19, 10, 0)},
+		{spec: "0 18 * * 5 64h", now: at(19, 10, 0), active: false},
+		// 星期7与0同为周日
+		{spec: "0 0 * * 7 24h", now: at(18, 23, 59), active: true, wantEnd: at(19, 0, 0)},
+		// 日与星期都受限时满足其一即可
+		{spec: "0 9 1 * 1 1h", now: at(19, 9, 30), active: true, wantEnd: at(19, 10, 0)},
+		{spec: "0 9 1 * 1 1h", now: at(20, 9, 30), active: false},
+		// 步长与范围
+		{spec: "*/15 9-17 * * 1-5 10m", now: at(16, 9, 50), active: true, wantEnd: at(16, 9, 55)},
+		{spec: "*/15 9-17 * * 1-5 10m", now: at(16, 9, 55), active: false},
+		{spec: "*/15 9-17 * * 1-5 10m", now: at(17, 9, 50), active: false},
+	}
+	for _, tt := range tests {
+		window, err := ParseFreezeWindow(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseFreezeWindow(%q): %v", tt.spec, err)
+		}
+		end, active := window.Active(tt.now)
+		if active != tt.active {
+			t.Errorf("%q.Active(%s) = %v, want %v", tt.spec, tt.now, active, tt.active)
+			continue
+		}
+		if active && !end.Equal(tt.wantEnd) {
+			t.Errorf("%q.Active(%s) end = %s, want %s", tt.spec, tt.now, end, tt.wantEnd)
+		}
+	}
+}
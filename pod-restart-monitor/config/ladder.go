@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 升级阶梯中只通知的步骤
+const LadderNotify = "notify"
+
+// LadderStep 升级阶梯的一步: 累计重启次数达到Restarts时执行Action
+type LadderStep struct {
+	Action   string
+	Restarts int
+}
+
+// ParseLadder 解析升级阶梯，格式为 "动作@重启次数"，逗号分隔，如 notify@2,delete-pod@4,rollback@6
+// 为空或 none 表示不使用升级阶梯
+func ParseLadder(input string) ([]LadderStep, error) {
+	cleaned := strings.TrimSpace(input)
+	if cleaned == "" || cleaned == "none" {
+		return nil, nil
+	}
+
+	var steps []LadderStep
+	for _, item := range parseList(cleaned) {
+		parts := strings.SplitN(item, "@", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid ladder step %q, expected action@restarts", item)
+		}
+		action := strings.ToLower(strings.TrimSpace(parts[0]))
+		if action != LadderNotify && !ValidRemediation(action) {
+			return nil, fmt.Errorf("unknown ladder action %q", action)
+		}
+		restarts, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || restarts <= 0 {
+			return nil, fmt.Errorf("invalid restart count in ladder step %q", item)
+		}
+		steps = append(steps, LadderStep{Action: action, Restarts: restarts})
+	}
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].Restarts < steps[j].Restarts
+	})
+	return steps, nil
+}
+
+func parseLadder(input string) []LadderStep {
+	steps, err := ParseLadder(input)
+	if err != nil {
+		logrus.WithField("ladder", input).WithError(err).Warn("Invalid ladder, using threshold")
+		return nil
+	}
+	return steps
+}
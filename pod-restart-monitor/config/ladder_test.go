@@ -0,0 +1,47 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLadder(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []LadderStep
+		wantErr bool
+	}{
+		{input: "", want: nil},
+		{input: "none", want: nil},
+		{
+			input: "notify@2, delete-pod@4,rollback@6",
+			want: []LadderStep{
+				{Action: LadderNotify, Restarts: 2},
+				{Action: RemediationDeletePod, Restarts: 4},
+				{Action: RemediationRollback, Restarts: 6},
+			},
+		},
+		{
+			// 按重启次数排序
+			input: "rollback@6,Notify@2",
+			want: []LadderStep{
+				{Action: LadderNotify, Restarts: 2},
+				{Action: RemediationRollback, Restarts: 6},
+			},
+		},
+		{input: "notify", wantErr: true},
+		{input: "reboot@3", wantErr: true},
+		{input: "notify@0", wantErr: true},
+		{input: "notify@x", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLadder(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLadder(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseLadder(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
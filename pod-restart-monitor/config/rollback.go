@@ -0,0 +1,124 @@
+package config
+
+import (
+	"github.com/sirupsen/logrus"
+	"os"
+	"strings"
+	"time"
+)
+
+// RollbackLimits 单个工作负载的回滚限制，防止连续回滚到越来越旧的版本
+type RollbackLimits struct {
+	MaxCount    int           // 周期内最多回滚次数，达到后熔断为只通知
+	Period      time.Duration // 回滚次数的统计周期，也是熔断持续时间
+	Cooldown    time.Duration // 两次回滚之间的最小间隔
+	MaxDepth    int           // 一轮连续回滚最多回退的版本数，0表示不限制
+	MinRevision int64         // 不回滚到版本号低于该值的版本，0表示不限制
+	MaxNodes    int           // cordon-node 最多同时封锁的节点数，0表示不限制
+}
+
+func parseRollbackLimits() RollbackLimits {
+	return RollbackLimits{
+		MaxCount:    parseNonNegativeInt(os.Getenv("ROLLBACK_MAX_COUNT"), 2),
+		Period:      parsePositiveDuration(os.Getenv("ROLLBACK_LIMIT_PERIOD"), 24*time.Hour),
+		Cooldown:    parseNonNegativeDuration(os.Getenv("ROLLBACK_COOLDOWN"), 30*time.Minute),
+		MaxDepth:    parseNonNegativeInt(os.Getenv("ROLLBACK_MAX_DEPTH"), 2),
+		MinRevision: int64(parseNonNegativeInt(os.Getenv("ROLLBACK_MIN_REVISION"), 0)),
+		MaxNodes:    parseNonNegativeInt(os.Getenv("CORDON_MAX_NODES"), 1),
+	}
+}
+
+func parsePositiveDuration(input string, defaultValue time.Duration) time.Duration {
+	duration, err := time.ParseDuration(strings.TrimSpace(input))
+	if err != nil || duration <= 0 {
+		return defaultValue
+	}
+	return duration
+}
+
+func parseNonNegativeDuration(input string, defaultValue time.Duration) time.Duration {
+	duration, err := time.ParseDuration(strings.TrimSpace(input))
+	if err != nil || duration < 0 {
+		return defaultValue
+	}
+	return duration
+}
+
+// 达到阈值后的处置动作
+const (
+	RemediationRollback       = "rollback"
+	RemediationRolloutRestart = "rollout-restart"
+	RemediationDeletePod      = "delete-pod"
+	RemediationPause          = "pause"
+	RemediationScaleZero      = "scale-zero"
+	RemediationCordonNode     = "cordon-node"
+	RemediationAnnotate       = "annotate"
+)
+
+// ValidRemediation 是否为支持的处置动作
+func ValidRemediation(name string) bool {
+	switch name {
+	case RemediationRollback, RemediationRolloutRestart, RemediationDeletePod, RemediationPause,
+		RemediationScaleZero, RemediationCordonNode, RemediationAnnotate:
+		return true
+	}
+	return false
+}
+
+// 解析处置动作，不填写默认回滚
+func parseRemediation(input string) string {
+	name := strings.ToLower(strings.TrimSpace(input))
+	if name == "" {
+		return RemediationRollback
+	}
+	if !ValidRemediation(name) {
+		logrus.WithField("remediation", input).Warn("Invalid remediation, using rollback")
+		return RemediationRollback
+	}
+	return name
+}
+
+// Helm管理的工作负载的回滚方式
+const (
+	HelmRollbackNotify  = "notify"  // 不修改工作负载，通知需要回滚的Release与版本
+	HelmRollbackRelease = "release" // 按Helm的方式回滚整个Release
+)
+
+func parseHelmRollback(input string) string {
+	mode := strings.ToLower(strings.TrimSpace(input))
+	switch mode {
+	case "":
+		return HelmRollbackNotify
+	case HelmRollbackNotify, HelmRollbackRelease:
+		return mode
+	}
+	logrus.WithField("helmRollback", input).Warn("Invalid helm rollback mode, using notify")
+	return HelmRollbackNotify
+}
+
+// GitOps管理的工作负载的回滚方式
+const (
+	GitOpsNotify         = "notify"          // 不回滚，通知需要在Git中回退的版本
+	GitOpsSuspend        = "suspend"         // 暂停Argo CD自动同步或Flux调谐后回滚
+	GitOpsArgoCDRollback = "argocd-rollback" // 按Argo CD应用历史回滚，Flux管理的工作负载暂停调谐后回滚
+)
+
+func parseGitOpsStrategy(input string) string {
+	strategy := strings.ToLower(strings.TrimSpace(input))
+	switch strategy {
+	case "":
+		return GitOpsNotify
+	case GitOpsNotify, GitOpsSuspend, GitOpsArgoCDRollback:
+		return strategy
+	}
+	logrus.WithField("gitopsStrategy", input).Warn("Invalid gitops strategy, using notify")
+	return GitOpsNotify
+}
+
+// Argo CD Application所在的命名空间，不填写默认argocd
+func parseArgoCDNamespace(input string) string {
+	if cleaned := strings.TrimSpace(input); cleaned != "" {
+		return cleaned
+	}
+	return "argocd"
+}
@@ -6,11 +6,8 @@ import (
 	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
 	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/monitor"
 	"github.com/sirupsen/logrus"
-	v1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"os/signal"
 	"syscall"
-	"time"
 )
 
 func main() {
@@ -19,7 +16,11 @@ func main() {
 	if err != nil {
 		logrus.Fatalf("Failed to create Kubernetes client: %v", err)
 	}
-	watcher := monitor.NewPodWatcher(clientset, cfg)
+	dynamicClient, err := k8sclient.NewDynamicClient(cfg.KubeconfigPath)
+	if err != nil {
+		logrus.Fatalf("Failed to create Kubernetes dynamic client: %v", err)
+	}
+	watcher := monitor.NewPodWatcher(clientset, dynamicClient, cfg)
 
 	// 优雅退出处理
 	// 创建一个带有信号通知的 Context
@@ -31,33 +32,41 @@ func main() {
 	)
 	defer cancel()
 
-	for _, ns := range cfg.Namespaces {
-		go func(namespace string) {
-			for {
-				watch, err := clientset.CoreV1().Pods(namespace).Watch(context.TODO(), metav1.ListOptions{})
-				if err != nil {
-					logrus.Error("Error creating watcher:", err)
-					time.Sleep(5 * time.Second)
-					continue
-				}
-
-				for event := range watch.ResultChan() {
-					pod, ok := event.Object.(*v1.Pod)
-					if !ok {
-						continue
-					}
-					if event.Type == "MODIFIED" {
-						monitor.HandlePodEvent(watcher, pod)
-					}
-				}
-			}
-		}(ns)
+	// kill switch在监听Pod之前同步，保证首个事件就受其控制
+	if err := monitor.StartKillSwitch(ctx, clientset, watcher, cfg); err != nil {
+		logrus.Fatalf("Failed to start kill switch: %v", err)
+	}
+
+	// 基于SharedInformer监听Pod，自动处理重新list与断线重连
+	informerManager := monitor.NewPodInformerManager(clientset, watcher, cfg)
+	var namespaceWatcher *monitor.NamespaceWatcher
+	if cfg.NamespaceSelector != "" || len(cfg.ExcludeNamespaces) > 0 {
+		// 按标签选择器与排除列表动态选择命名空间
+		namespaceWatcher, err = monitor.NewNamespaceWatcher(clientset, informerManager, cfg)
+		if err != nil {
+			logrus.Fatalf("Failed to create namespace watcher: %v", err)
+		}
+		if err := namespaceWatcher.Start(ctx); err != nil {
+			logrus.Fatalf("Failed to start namespace watcher: %v", err)
+		}
+	} else if err := informerManager.Start(ctx); err != nil {
+		logrus.Fatalf("Failed to start pod informers: %v", err)
 	}
 
 	// 启动清理协程
 	go monitor.StartCleanupRoutine(ctx, watcher, cfg)
 
+	// 审批模式下接收飞书卡片与企业微信链接的回调
+	if cfg.Approval.ListenAddr != "" {
+		go monitor.StartApprovalServer(ctx, watcher, cfg)
+	}
+
 	// 阻塞当前 Goroutine，直到调用cancel()，才会继续执行
 	<-ctx.Done()
-	time.Sleep(10 * time.Second) // 等待资源释放
+	// 先停止后台任务，再等待informer协程退出
+	watcher.Shutdown()
+	if namespaceWatcher != nil {
+		namespaceWatcher.Shutdown()
+	}
+	informerManager.Shutdown()
 }
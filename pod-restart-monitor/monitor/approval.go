@@ -0,0 +1,307 @@
+package monitor
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/notify"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 审批不存在，可能已被处理或已超时
+var errApprovalNotFound = errors.New("approval not found or already resolved")
+
+// 等待人工审批的处置动作
+type pendingApproval struct {
+	detail     notify.ApprovalDetail
+	pod        *v1.Pod
+	key        string
+	record     PodRecord
+	policy     Policy
+	logTail    *LogTail
+	generation int64 // 发起审批时工作负载的generation，审批通过时已变化说明有新的发布，放弃执行
+	timer      *time.Timer
+}
+
+type approvalManager struct {
+	mu      sync.Mutex
+	pending map[string]*pendingApproval
+	byKey   map[string]string // 记录键 -> 审批ID，同一工作负载同时只有一个待审批
+	snoozed map[*time.Timer]bool
+	stopped bool
+}
+
+func newApprovalManager() *approvalManager {
+	return &approvalManager{
+		pending: make(map[string]*pendingApproval),
+		byKey:   make(map[string]string),
+		snoozed: make(map[*time.Timer]bool),
+	}
+}
+
+// 退出时停止所有审批超时与稍后处理的定时器
+func (m *approvalManager) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopped = true
+	for _, p := range m.pending {
+		p.timer.Stop()
+	}
+	for timer := range m.snoozed {
+		timer.Stop()
+	}
+}
+
+// 发起处置动作审批，同一工作负载已有待审批时不重复发起
+func (w *PodWatcher) requestApproval(pod *v1.Pod, key string, record PodRecord, policy Policy, logTail *LogTail, now time.Time) {
+	approval := w.config.Approval
+	var generation int64
+	if meta, err := w.workloadMeta(record); err == nil {
+		generation = meta.Generation
+	}
+	w.approvals.mu.Lock()
+	if w.approvals.stopped {
+		w.approvals.mu.Unlock()
+		return
+	}
+	if id, exists := w.approvals.byKey[key]; exists {
+		w.approvals.mu.Unlock()
+		logrus.WithFields(logrus.Fields{
+			"workload": record.Workload(),
+			"approval": id,
+		}).Info("Approval already pending")
+		return
+	}
+
+	id := newApprovalID()
+	p := &pendingApproval{
+		detail: notify.ApprovalDetail{
+			ID:        id,
+			Action:    policy.Remediation,
+			Workload:  record.Workload(),
+			Namespace: record.Namespace,
+			PodName:   pod.Name,
+			Reason: fmt.Sprintf("%d restarts, %d replicas in CrashLoopBackOff",
+				record.RestartCount, record.crashLoopingReplicas()),
+			Cause:         record.ProbableCause.String(),
+			Deadline:      now.Add(approval.Timeout),
+			DefaultAction: approval.DefaultAction,
+		},
+		pod:        pod,
+		key:        key,
+		record:     record,
+		policy:     policy,
+		logTail:    logTail,
+		generation: generation,
+	}
+	p.detail.Links = w.approvalLinks(id, p.detail.Deadline)
+	p.timer = time.AfterFunc(approval.Timeout, func() {
+		if err := w.resolveApproval(id, approval.DefaultAction, "timeout"); err == nil {
+			logrus.WithField("approval", id).Info("Approval timed out, default action applied")
+		}
+	})
+	w.approvals.pending[id] = p
+	w.approvals.byKey[key] = id
+	w.approvals.mu.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"workload": record.Workload(),
+		"approval": id,
+		"deadline": p.detail.Deadline,
+	}).Info("Approval requested")
+
+	notifyType, webhook := w.notifyTarget(policy.NotifyChannel)
+	switch notifyType {
+	case "lark":
+		notify.SendLarkCard(webhook, notify.GetLarkApprovalCard(p.detail))
+	default:
+		w.sendNotification(policy.NotifyChannel, notify.GetApprovalMessage(p.detail))
+	}
+}
+
+// 处理审批结果: 批准后执行处置动作，拒绝只通知，稍后处理则延后重新发起审批
+func (w *PodWatcher) resolveApproval(id, action, operator string) error {
+	w.approvals.mu.Lock()
+	p, exists := w.approvals.pending[id]
+	if !exists {
+		w.approvals.mu.Unlock()
+		return errApprovalNotFound
+	}
+	delete(w.approvals.pending, id)
+	delete(w.approvals.byKey, p.key)
+	p.timer.Stop()
+	w.approvals.mu.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"workload": p.detail.Workload,
+		"approval": id,
+		"action":   action,
+		"operator": operator,
+	}).Info("Approval resolved")
+	w.sendNotification(p.policy.NotifyChannel, notify.GetApprovalResultMessage(p.detail, action, operator))
+
+	switch action {
+	case config.ApprovalApprove:
+		pod, record, reason := w.revalidateApproval(p, true)
+		if reason != "" {
+			logrus.WithFields(logrus.Fields{
+				"workload": p.detail.Workload,
+				"approval": id,
+				"reason":   reason,
+			}).Warn("Approved action dropped")
+			w.sendNotification(p.policy.NotifyChannel, fmt.Sprintf("Approval %s for %s dropped, %s not executed: %s",
+				id, p.detail.Workload, p.detail.Action, reason))
+			return nil
+		}
+		policy := p.policy
+		policy.Rollback = config.RollbackModeOn
+		go w.remediate(pod, p.key, time.Now(), policy, record, p.logTail)
+	case config.ApprovalSnooze:
+		w.snoozeApproval(p)
+	}
+	return nil
+}
+
+// 稍后处理: 到期时工作负载仍在崩溃才重新发起审批
+func (w *PodWatcher) snoozeApproval(p *pendingApproval) {
+	w.approvals.mu.Lock()
+	defer w.approvals.mu.Unlock()
+	if w.approvals.stopped {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(w.config.Approval.SnoozeDuration, func() {
+		w.approvals.mu.Lock()
+		delete(w.approvals.snoozed, timer)
+		w.approvals.mu.Unlock()
+
+		pod, record, reason := w.revalidateApproval(p, false)
+		if reason != "" {
+			logrus.WithFields(logrus.Fields{
+				"workload": p.detail.Workload,
+				"reason":   reason,
+			}).Info("Snoozed approval not requested again")
+			return
+		}
+		w.requestApproval(pod, p.key, record, p.policy, p.logTail, time.Now())
+	})
+	w.approvals.snoozed[timer] = true
+}
+
+// 审批期间情况可能已变化: 返回最新的崩溃Pod与记录，或不再执行的原因
+// 审批超时通常长于统计窗口，记录可能已被清理，以工作负载的实时Pod判断是否仍在崩溃；checkGeneration时工作负载有新的发布也不再执行
+func (w *PodWatcher) revalidateApproval(p *pendingApproval, checkGeneration bool) (*v1.Pod, PodRecord, string) {
+	if w.ctx.Err() != nil {
+		return nil, PodRecord{}, "podsentry is shutting down"
+	}
+	w.recordsMu.RLock()
+	record, exists := w.records[p.key]
+	w.recordsMu.RUnlock()
+	if !exists {
+		record = p.record
+	}
+
+	pod, err := w.crashingWorkloadPod(p.key, record, p.policy)
+	if err != nil {
+		return nil, record, err.Error()
+	}
+	// 镜像拉取失败等异常没有重启，记录中仍有窗口内的异常时继续执行
+	if pod == nil && exists && len(record.Findings) > 0 && time.Since(record.LastFinding) <= record.TimeWindow {
+		pod, err = w.client.CoreV1().Pods(record.Namespace).Get(context.TODO(), record.PodName, metav1.GetOptions{})
+		if err != nil {
+			return nil, record, fmt.Sprintf("failed to get pod %s: %v", record.PodName, err)
+		}
+	}
+	if pod == nil {
+		return nil, record, "workload is no longer crash-looping"
+	}
+
+	if checkGeneration && p.generation != 0 {
+		meta, err := w.workloadMeta(record)
+		if err != nil {
+			return nil, record, err.Error()
+		}
+		if meta.Generation != p.generation {
+			return nil, record, fmt.Sprintf("workload changed since approval was requested (generation %d -> %d)", p.generation, meta.Generation)
+		}
+	}
+	return pod, record, ""
+}
+
+// 查找工作负载中仍在崩溃的Pod: 处于CrashLoopBackOff，或容器重启次数较记录时增加；没有时返回nil
+func (w *PodWatcher) crashingWorkloadPod(key string, record PodRecord, policy Policy) (*v1.Pod, error) {
+	pods, err := w.client.CoreV1().Pods(record.Namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || !(len(crashLoopingContainers(pod, policy)) > 0 || restartedSince(pod, record, policy)) {
+			continue
+		}
+		workload, err := w.resolveWorkload(pod)
+		if err != nil || recordKey(pod, workload) != key {
+			continue
+		}
+		return pod, nil
+	}
+	return nil, nil
+}
+
+// 记录中的Pod是否有容器重启次数增加
+func restartedSince(pod *v1.Pod, record PodRecord, policy Policy) bool {
+	state, exists := record.Pods[string(pod.UID)]
+	if !exists {
+		return false
+	}
+	for name, count := range containerRestartCounts(pod) {
+		if policy.watchesContainer(name) && count > state.ContainerRestarts[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// 企业微信不支持卡片回调，使用带HMAC签名的审批链接
+func (w *PodWatcher) approvalLinks(id string, expires time.Time) map[string]string {
+	approval := w.config.Approval
+	if approval.CallbackURL == "" || approval.Secret == "" {
+		return nil
+	}
+
+	links := make(map[string]string)
+	for _, action := range []string{config.ApprovalApprove, config.ApprovalReject, config.ApprovalSnooze} {
+		query := url.Values{}
+		query.Set("id", id)
+		query.Set("action", action)
+		query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+		query.Set("sig", approvalSignature(approval.Secret, id, action, expires.Unix()))
+		links[action] = approval.CallbackURL + approvalLinkPath + "?" + query.Encode()
+	}
+	return links
+}
+
+func approvalSignature(secret, id, action string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%s|%s|%d", id, action, expires)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newApprovalID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
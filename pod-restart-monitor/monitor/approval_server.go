@@ -0,0 +1,258 @@
+package monitor
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"html"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	larkCallbackPath = "/approval/lark"
+	approvalLinkPath = "/approval/wechat"
+
+	maxCallbackBody = 1 << 20
+)
+
+// 飞书卡片回调，兼容旧版消息卡片与新版 card.action.trigger 事件
+type larkCallback struct {
+	Type      string      `json:"type"`
+	Challenge string      `json:"challenge"`
+	Token     string      `json:"token"`
+	OpenID    string      `json:"open_id"`
+	Action    *larkAction `json:"action"`
+	Header    struct {
+		Token string `json:"token"`
+	} `json:"header"`
+	Event *struct {
+		Operator struct {
+			OpenID string `json:"open_id"`
+		} `json:"operator"`
+		Action *larkAction `json:"action"`
+	} `json:"event"`
+}
+
+type larkAction struct {
+	Value map[string]string `json:"value"`
+}
+
+// StartApprovalServer 启动审批回调HTTP服务，ctx取消时关闭
+func StartApprovalServer(ctx context.Context, w *PodWatcher, cfg *config.Config) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(larkCallbackPath, w.handleLarkCallback)
+	mux.HandleFunc(approvalLinkPath, w.handleApprovalLink)
+
+	server := &http.Server{
+		Addr:              cfg.Approval.ListenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logrus.WithField("addr", cfg.Approval.ListenAddr).Info("Approval server started")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logrus.WithError(err).Error("Approval server stopped")
+	}
+}
+
+// 处理飞书卡片按钮回调
+func (w *PodWatcher) handleLarkCallback(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCallbackBody))
+	if err != nil {
+		http.Error(rw, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	approval := w.config.Approval
+	signed := r.Header.Get("X-Lark-Signature") != ""
+	if signed {
+		if err := verifyLarkSignature(r.Header, body, approval, time.Now()); err != nil {
+			logrus.WithError(err).Warn("Rejected lark callback")
+			http.Error(rw, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	payload, err := decryptLarkBody(body, approval.LarkEncryptKey)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var callback larkCallback
+	if err := json.Unmarshal(payload, &callback); err != nil {
+		http.Error(rw, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	token := callback.Token
+	if token == "" {
+		token = callback.Header.Token
+	}
+	if approval.LarkVerifyToken != "" && !hmac.Equal([]byte(token), []byte(approval.LarkVerifyToken)) {
+		http.Error(rw, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	// 配置回调地址时的校验请求，只回显challenge
+	if callback.Type == "url_verification" {
+		writeJSON(rw, map[string]string{"challenge": callback.Challenge})
+		return
+	}
+	if !signed {
+		http.Error(rw, "missing signature", http.StatusUnauthorized)
+		return
+	}
+
+	action, operator := callback.Action, callback.OpenID
+	if callback.Event != nil {
+		action, operator = callback.Event.Action, callback.Event.Operator.OpenID
+	}
+	if action == nil || !validApprovalAction(action.Value["action"]) {
+		http.Error(rw, "invalid action", http.StatusBadRequest)
+		return
+	}
+
+	if err := w.resolveApproval(action.Value["approval_id"], action.Value["action"], "lark:"+operator); err != nil {
+		logrus.WithError(err).Warn("Failed to resolve approval from lark")
+	}
+	writeJSON(rw, map[string]interface{}{})
+}
+
+// 飞书签名: 新版事件为 sha256(timestamp+nonce+encryptKey+body)，旧版卡片为 sha1(timestamp+nonce+token+body)
+func verifyLarkSignature(header http.Header, body []byte, approval config.ApprovalConfig, now time.Time) error {
+	timestamp := header.Get("X-Lark-Request-Timestamp")
+	nonce := header.Get("X-Lark-Request-Nonce")
+	signature := header.Get("X-Lark-Signature")
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > approval.SignatureValidity || age < -approval.SignatureValidity {
+		return fmt.Errorf("timestamp %s outside validity window", timestamp)
+	}
+
+	if approval.LarkEncryptKey != "" {
+		sum := sha256.Sum256([]byte(timestamp + nonce + approval.LarkEncryptKey + string(body)))
+		if hmac.Equal([]byte(hex.EncodeToString(sum[:])), []byte(signature)) {
+			return nil
+		}
+	}
+	if approval.LarkVerifyToken != "" {
+		sum := sha1.Sum([]byte(timestamp + nonce + approval.LarkVerifyToken + string(body)))
+		if hmac.Equal([]byte(hex.EncodeToString(sum[:])), []byte(signature)) {
+			return nil
+		}
+	}
+	return errors.New("signature mismatch")
+}
+
+// 配置了Encrypt Key时飞书以AES-256-CBC加密回调内容，密钥为Encrypt Key的sha256，前16字节为IV
+func decryptLarkBody(body []byte, encryptKey string) ([]byte, error) {
+	var envelope struct {
+		Encrypt string `json:"encrypt"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Encrypt == "" {
+		return body, nil
+	}
+	if encryptKey == "" {
+		return nil, errors.New("encrypted callback but APPROVAL_LARK_ENCRYPT_KEY is not set")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(envelope.Encrypt)
+	if err != nil || len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted payload")
+	}
+	key := sha256.Sum256([]byte(encryptKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(plain, data[aes.BlockSize:])
+
+	// 去掉PKCS#7填充
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(plain) {
+		return nil, errors.New("invalid encrypted payload padding")
+	}
+	return plain[:len(plain)-padding], nil
+}
+
+// 处理企业微信审批链接: GET返回确认页面，POST校验签名后执行，避免链接预览误触发
+func (w *PodWatcher) handleApprovalLink(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	id, action := query.Get("id"), query.Get("action")
+	if !validApprovalAction(action) {
+		http.Error(rw, "invalid action", http.StatusBadRequest)
+		return
+	}
+	if err := verifyApprovalLink(w.config.Approval, id, action, query.Get("expires"), query.Get("sig"), time.Now()); err != nil {
+		logrus.WithError(err).Warn("Rejected approval link")
+		http.Error(rw, "invalid or expired link", http.StatusUnauthorized)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	switch r.Method {
+	case http.MethodGet:
+		fmt.Fprintf(rw, `<html><body><form method="POST" action="%s?%s"><button type="submit">Confirm %s</button></form></body></html>`,
+			approvalLinkPath, html.EscapeString(r.URL.RawQuery), html.EscapeString(action))
+	case http.MethodPost:
+		if err := w.resolveApproval(id, action, "wechat-link"); err != nil {
+			fmt.Fprintf(rw, "<html><body>%s</body></html>", html.EscapeString(err.Error()))
+			return
+		}
+		fmt.Fprintf(rw, "<html><body>Rollback %s accepted</body></html>", html.EscapeString(action))
+	default:
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func verifyApprovalLink(approval config.ApprovalConfig, id, action, expires, signature string, now time.Time) error {
+	if approval.Secret == "" {
+		return errors.New("APPROVAL_SECRET is not set")
+	}
+	seconds, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid expires %q", expires)
+	}
+	if now.After(time.Unix(seconds, 0)) {
+		return errors.New("link expired")
+	}
+	if !hmac.Equal([]byte(approvalSignature(approval.Secret, id, action, seconds)), []byte(signature)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func validApprovalAction(action string) bool {
+	return action == config.ApprovalApprove || action == config.ApprovalReject || action == config.ApprovalSnooze
+}
+
+func writeJSON(rw http.ResponseWriter, value interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(value)
+}
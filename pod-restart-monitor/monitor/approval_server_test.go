@@ -0,0 +1,147 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func larkHeader(timestamp time.Time, nonce, signature string) http.Header {
+	header := http.Header{}
+	header.Set("X-Lark-Request-Timestamp", strconv.FormatInt(timestamp.Unix(), 10))
+	header.Set("X-Lark-Request-Nonce", nonce)
+	header.Set("X-Lark-Signature", signature)
+	return header
+}
+
+func TestVerifyLarkSignature(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"action":{"value":{"action":"approve"}}}`)
+	approval := config.ApprovalConfig{LarkEncryptKey: "encrypt-key", LarkVerifyToken: "verify-token", SignatureValidity: 5 * time.Minute}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	sha256Sum := sha256.Sum256([]byte(timestamp + "nonce" + "encrypt-key" + string(body)))
+	sha1Sum := sha1.Sum([]byte(timestamp + "nonce" + "verify-token" + string(body)))
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		body    []byte
+		config  config.ApprovalConfig
+		wantErr bool
+	}{
+		{name: "event signature", header: larkHeader(now, "nonce", hex.EncodeToString(sha256Sum[:])), body: body, config: approval},
+		{name: "card signature", header: larkHeader(now, "nonce", hex.EncodeToString(sha1Sum[:])), body: body, config: approval},
+		{name: "tampered body", header: larkHeader(now, "nonce", hex.EncodeToString(sha256Sum[:])), body: []byte(`{}`), config: approval, wantErr: true},
+		{name: "wrong nonce", header: larkHeader(now, "other", hex.EncodeToString(sha256Sum[:])), body: body, config: approval, wantErr: true},
+		{name: "expired timestamp", header: larkHeader(now.Add(-10*time.Minute), "nonce", hex.EncodeToString(sha256Sum[:])), body: body, config: approval, wantErr: true},
+		{name: "future timestamp", header: larkHeader(now.Add(10*time.Minute), "nonce", hex.EncodeToString(sha256Sum[:])), body: body, config: approval, wantErr: true},
+		{
+			name:    "no keys configured",
+			header:  larkHeader(now, "nonce", hex.EncodeToString(sha256Sum[:])),
+			body:    body,
+			config:  config.ApprovalConfig{SignatureValidity: 5 * time.Minute},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyLarkSignature(tt.header, tt.body, tt.config, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	header := larkHeader(now, "nonce", hex.EncodeToString(sha256Sum[:]))
+	header.Set("X-Lark-Request-Timestamp", "yesterday")
+	if err := verifyLarkSignature(header, body, approval, now); err == nil {
+		t.Error("expected error for invalid timestamp")
+	}
+}
+
+// 与飞书一致: AES-256-CBC，密钥为Encrypt Key的sha256，随机IV置于密文之前，PKCS#7填充
+func encryptLarkBody(t *testing.T, plain []byte, encryptKey string) []byte {
+	t.Helper()
+	key := sha256.Sum256([]byte(encryptKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	padded := append(append([]byte(nil), plain...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	iv := bytes.Repeat([]byte{7}, aes.BlockSize)
+	data := make([]byte, aes.BlockSize+len(padded))
+	copy(data, iv)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data[aes.BlockSize:], padded)
+	return []byte(`{"encrypt":"` + base64.StdEncoding.EncodeToString(data) + `"}`)
+}
+
+func TestDecryptLarkBody(t *testing.T) {
+	plain := []byte(`{"type":"url_verification","challenge":"abc"}`)
+	body := encryptLarkBody(t, plain, "encrypt-key")
+
+	decrypted, err := decryptLarkBody(body, "encrypt-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Errorf("decrypted = %s, want %s", decrypted, plain)
+	}
+
+	// 未加密的回调原样返回
+	if decrypted, err := decryptLarkBody(plain, "encrypt-key"); err != nil || !bytes.Equal(decrypted, plain) {
+		t.Errorf("plain body = %s, %v", decrypted, err)
+	}
+	if _, err := decryptLarkBody(body, ""); err == nil {
+		t.Error("expected error without encrypt key")
+	}
+	if _, err := decryptLarkBody([]byte(`{"encrypt":"c2hvcnQ="}`), "encrypt-key"); err == nil {
+		t.Error("expected error for short payload")
+	}
+}
+
+func TestVerifyApprovalLink(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	approval := config.ApprovalConfig{Secret: "secret"}
+	expires := now.Add(time.Hour).Unix()
+	signature := approvalSignature("secret", "id-1", config.ApprovalApprove, expires)
+	expiresText := strconv.FormatInt(expires, 10)
+
+	tests := []struct {
+		name      string
+		config    config.ApprovalConfig
+		id        string
+		action    string
+		expires   string
+		signature string
+		now       time.Time
+		wantErr   bool
+	}{
+		{name: "valid", config: approval, id: "id-1", action: config.ApprovalApprove, expires: expiresText, signature: signature, now: now},
+		{name: "expired", config: approval, id: "id-1", action: config.ApprovalApprove, expires: expiresText, signature: signature, now: now.Add(2 * time.Hour), wantErr: true},
+		{name: "action changed", config: approval, id: "id-1", action: config.ApprovalReject, expires: expiresText, signature: signature, now: now, wantErr: true},
+		{name: "approval changed", config: approval, id: "id-2", action: config.ApprovalApprove, expires: expiresText, signature: signature, now: now, wantErr: true},
+		{name: "expiry extended", config: approval, id: "id-1", action: config.ApprovalApprove, expires: strconv.FormatInt(expires+3600, 10), signature: signature, now: now, wantErr: true},
+		{name: "invalid expiry", config: approval, id: "id-1", action: config.ApprovalApprove, expires: "never", signature: signature, now: now, wantErr: true},
+		{name: "no secret", config: config.ApprovalConfig{}, id: "id-1", action: config.ApprovalApprove, expires: expiresText, signature: signature, now: now, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyApprovalLink(tt.config, tt.id, tt.action, tt.expires, tt.signature, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
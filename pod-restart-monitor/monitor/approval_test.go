@@ -0,0 +1,51 @@
+package monitor
+
+import (
+	"context"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
+	"testing"
+)
+
+func TestRevalidateApprovalAfterRecordCleanup(t *testing.T) {
+	pod := crashingDeploymentPod()
+	pod.UID = "uid-web"
+	pod.Status.ContainerStatuses = []v1.ContainerStatus{{
+		Name:         "app",
+		RestartCount: 5,
+		State:        v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+	}}
+	watcher, client := newTestWatcher(t, nil, append(deploymentHistory(nil), pod)...)
+
+	// 审批期间记录已按统计窗口清理，只剩发起审批时的快照
+	p := &pendingApproval{
+		key: "Deployment/default/web",
+		record: PodRecord{
+			Namespace:    "default",
+			WorkloadKind: "Deployment",
+			WorkloadName: "web",
+			Pods:         map[string]PodState{"uid-web": {PodName: pod.Name, ContainerRestarts: map[string]int32{"app": 5}}},
+		},
+	}
+	got, _, reason := watcher.revalidateApproval(p, false)
+	if reason != "" || got == nil || got.Name != pod.Name {
+		t.Fatalf("revalidateApproval = %v, %q, want crash-looping pod %s", got, reason, pod.Name)
+	}
+
+	// 容器暂时处于运行状态，但重启次数较发起审批时增加
+	pod.Status.ContainerStatuses[0].State = v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+	pod.Status.ContainerStatuses[0].RestartCount = 6
+	if _, err := client.CoreV1().Pods("default").UpdateStatus(context.TODO(), pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, reason := watcher.revalidateApproval(p, false); reason != "" || got == nil {
+		t.Fatalf("revalidateApproval = %v, %q after another restart", got, reason)
+	}
+
+	// 已恢复
+	p.record.Pods["uid-web"] = PodState{PodName: pod.Name, ContainerRestarts: map[string]int32{"app": 6}}
+	if _, _, reason := watcher.revalidateApproval(p, false); !strings.Contains(reason, "no longer crash-looping") {
+		t.Errorf("reason = %q, want no longer crash-looping", reason)
+	}
+}
@@ -0,0 +1,232 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"strconv"
+	"strings"
+)
+
+// Argo Rollouts 在ReplicaSet与Pod上使用的注解与标签
+const (
+	argoRolloutRevisionAnnotation = "rollout.argoproj.io/revision"
+	argoRolloutPodTemplateHash    = "rollouts-pod-template-hash"
+)
+
+// Rollout恢复的模板同样获得新的版本号，本轮回滚掉的版本按pod模板哈希记录
+const schemeArgoRollout = "rollout"
+
+var argoRolloutResource = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}
+
+func getArgoRollout(client dynamic.Interface, namespace, name string) (*unstructured.Unstructured, error) {
+	if client == nil {
+		return nil, errors.New("dynamic client is not configured for argo rollouts")
+	}
+	rollout, err := client.Resource(argoRolloutResource).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rollout: %w", err)
+	}
+	return rollout, nil
+}
+
+func unstructuredMeta(obj *unstructured.Unstructured) *metav1.ObjectMeta {
+	return &metav1.ObjectMeta{
+		Name:        obj.GetName(),
+		Namespace:   obj.GetNamespace(),
+		Labels:      obj.GetLabels(),
+		Annotations: obj.GetAnnotations(),
+		Generation:  obj.GetGeneration(),
+	}
+}
+
+// Rollout的阶段与说明，用于通知
+func argoRolloutPhase(rollout *unstructured.Unstructured) string {
+	phase, _, _ := unstructured.NestedString(rollout.Object, "status", "phase")
+	message, _, _ := unstructured.NestedString(rollout.Object, "status", "message")
+	if phase == "" {
+		phase = "Unknown"
+	}
+	description := "phase " + phase
+	if index, found, _ := unstructured.NestedInt64(rollout.Object, "status", "currentStepIndex"); found {
+		steps, _, _ := unstructured.NestedSlice(rollout.Object, "spec", "strategy", "canary", "steps")
+		description = fmt.Sprintf("%s, step %d/%d", description, index, len(steps))
+	}
+	if message != "" {
+		description = fmt.Sprintf("%s: %s", description, message)
+	}
+	return description
+}
+
+// 回滚Argo Rollout: 发布进行中时先中止，然后与 kubectl argo rollouts undo 一致恢复稳定版本的模板；
+// 已完成发布的Rollout稳定版本即当前版本，回滚到上一个版本
+func (w *PodWatcher) rollbackArgoRollout(record PodRecord, opts RollbackOptions) (*RollbackResult, error) {
+	rollout, err := getArgoRollout(w.dynamic, record.Namespace, record.WorkloadName)
+	if err != nil {
+		return nil, err
+	}
+	if _, found, _ := unstructured.NestedMap(rollout.Object, "spec", "workloadRef"); found {
+		return nil, fmt.Errorf("rollout %s references a workload, undo is not supported", rollout.GetName())
+	}
+	phase := argoRolloutPhase(rollout)
+	stableHash, _, _ := unstructured.NestedString(rollout.Object, "status", "stableRS")
+	currentHash, _, _ := unstructured.NestedString(rollout.Object, "status", "currentPodHash")
+
+	rsList, err := w.argoRolloutReplicaSets(rollout)
+	if err != nil {
+		return nil, err
+	}
+	var current, target *appsv1.ReplicaSet
+	for i := range rsList {
+		if rsList[i].Labels[argoRolloutPodTemplateHash] == currentHash {
+			current = &rsList[i]
+		}
+	}
+	if current == nil {
+		return nil, fmt.Errorf("replica set of current pod hash %s not found", currentHash)
+	}
+	inProgress := stableHash != "" && stableHash != currentHash
+	for i := range rsList {
+		rs := &rsList[i]
+		switch {
+		case inProgress && rs.Labels[argoRolloutPodTemplateHash] == stableHash:
+			target = rs
+		case !inProgress && argoRevision(rs) < argoRevision(current) && (target == nil || argoRevision(rs) > argoRevision(target)) &&
+			!opts.skips(schemeArgoRollout, rs.Labels[argoRolloutPodTemplateHash]):
+			target = rs
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("no stable or previous replica set to roll back rollout %s to", rollout.GetName())
+	}
+	from, to := argoRevision(current), argoRevision(target)
+	if err := opts.checkTarget(schemeArgoRollout, target.Labels[argoRolloutPodTemplateHash], to); err != nil {
+		return nil, err
+	}
+
+	client := w.dynamic.Resource(argoRolloutResource).Namespace(record.Namespace)
+	patchOpts := metav1.PatchOptions{DryRun: dryRunOption(opts.DryRun)}
+	if inProgress {
+		// 与 kubectl argo rollouts abort 一致，流量与副本立即切回稳定版本
+		_, err := client.Patch(context.TODO(), rollout.GetName(), types.MergePatchType, []byte(`{"status":{"abort":true}}`), patchOpts, "status")
+		if err != nil {
+			return nil, fmt.Errorf("failed to abort rollout: %w", err)
+		}
+		logrus.WithFields(logrus.Fields{
+			"rollout": rollout.GetName(),
+			"dryRun":  opts.DryRun,
+		}).Info("Rollout aborted")
+	}
+
+	template := target.Spec.Template.DeepCopy()
+	delete(template.Labels, argoRolloutPodTemplateHash)
+	patch, err := argoRolloutUndoPatch(rollout, template, from, to)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := client.Patch(context.TODO(), rollout.GetName(), types.JSONPatchType, patch, patchOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to undo rollout: %w", err)
+	}
+
+	var previous v1.PodTemplateSpec
+	if raw, found, _ := unstructured.NestedMap(rollout.Object, "spec", "template"); found {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &previous); err != nil {
+			return nil, fmt.Errorf("invalid rollout template: %w", err)
+		}
+	}
+	note := "rollout was " + phase
+	if inProgress {
+		note = fmt.Sprintf("rollout aborted at %s, restoring stable replica set %s", phase, target.Name)
+	}
+	return &RollbackResult{
+		Kind:         "Rollout",
+		Name:         rollout.GetName(),
+		Namespace:    rollout.GetNamespace(),
+		FromRevision: from,
+		ToRevision:   to,
+		DryRun:       opts.DryRun,
+		Generation:   updated.GetGeneration(),
+		Diff:         templateDiff(previous, *template),
+		Note:         note,
+		Scheme:       schemeArgoRollout,
+		FromVersion:  currentHash,
+	}, nil
+}
+
+// Rollout拥有的ReplicaSet
+func (w *PodWatcher) argoRolloutReplicaSets(rollout *unstructured.Unstructured) ([]appsv1.ReplicaSet, error) {
+	list, err := w.client.AppsV1().ReplicaSets(rollout.GetNamespace()).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replica sets: %w", err)
+	}
+	var owned []appsv1.ReplicaSet
+	for _, rs := range list.Items {
+		if ref := metav1.GetControllerOf(&rs); ref != nil && ref.Kind == "Rollout" && ref.UID == rollout.GetUID() {
+			owned = append(owned, rs)
+		}
+	}
+	return owned, nil
+}
+
+func argoRevision(rs *appsv1.ReplicaSet) int64 {
+	revision, _ := strconv.ParseInt(rs.Annotations[argoRolloutRevisionAnnotation], 10, 64)
+	return revision
+}
+
+// 整体替换模板并记录回滚注解
+func argoRolloutUndoPatch(rollout *unstructured.Unstructured, template *v1.PodTemplateSpec, from, to int64) ([]byte, error) {
+	ops := []map[string]interface{}{
+		{"op": "replace", "path": "/spec/template", "value": template},
+	}
+	annotations := rollbackAnnotations(from, to)
+	if rollout.GetAnnotations() == nil {
+		ops = append(ops, map[string]interface{}{"op": "add", "path": "/metadata/annotations", "value": annotations})
+	} else {
+		for key, value := range annotations {
+			ops = append(ops, map[string]interface{}{"op": "add", "path": "/metadata/annotations/" + escapeJSONPointer(key), "value": value})
+		}
+	}
+	return json.Marshal(ops)
+}
+
+func escapeJSONPointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+// 与 kubectl argo rollouts status 的判断一致
+func argoRolloutStatus(rollout *unstructured.Unstructured, generation int64) RolloutStatus {
+	progress := argoRolloutPhase(rollout)
+	// observedGeneration 在Argo Rollouts中为字符串
+	observed, _, _ := unstructured.NestedFieldNoCopy(rollout.Object, "status", "observedGeneration")
+	var observedGeneration int64
+	switch value := observed.(type) {
+	case string:
+		observedGeneration, _ = strconv.ParseInt(value, 10, 64)
+	case int64:
+		observedGeneration = value
+	}
+	if observedGeneration < generation || observedGeneration < rollout.GetGeneration() {
+		return RolloutStatus{Progress: "waiting for controller to observe the rollback"}
+	}
+
+	phase, _, _ := unstructured.NestedString(rollout.Object, "status", "phase")
+	switch phase {
+	case "Healthy":
+		return RolloutStatus{Done: true, Progress: progress}
+	case "Degraded":
+		message, _, _ := unstructured.NestedString(rollout.Object, "status", "message")
+		return RolloutStatus{Failed: message, Progress: progress}
+	}
+	return RolloutStatus{Progress: progress}
+}
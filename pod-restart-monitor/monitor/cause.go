@@ -0,0 +1,110 @@
+package monitor
+
+import (
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/notify"
+	"fmt"
+)
+
+// 可能原因的分类
+const (
+	CauseCategoryApplication = "application"
+	CauseCategoryResource    = "resource"
+	CauseCategoryDependency  = "dependency"
+	CauseCategoryConfig      = "config"
+	CauseCategoryPermission  = "permission"
+	CauseCategoryProbe       = "probe"
+	CauseCategoryUnknown     = "unknown"
+)
+
+// ProbableCause 根据退出码、终止原因和日志推断的崩溃原因
+type ProbableCause struct {
+	Category string
+	Name     string
+	Detail   string
+}
+
+func (c ProbableCause) String() string {
+	if c.Name == "" {
+		return "-"
+	}
+	if c.Detail == "" {
+		return fmt.Sprintf("%s/%s", c.Category, c.Name)
+	}
+	return fmt.Sprintf("%s/%s (%s)", c.Category, c.Name, c.Detail)
+}
+
+// 推断崩溃原因，优先级: 终止原因OOMKilled > 日志特征 > 探针失败事件 > 退出码
+func (w *PodWatcher) classifyCause(record PodRecord, logTail *LogTail) ProbableCause {
+	var container ContainerRecord
+	if len(record.Restarts) > 0 {
+		container = record.Containers[record.Restarts[len(record.Restarts)-1].Container]
+	}
+
+	if container.LastReason == "OOMKilled" {
+		return ProbableCause{Category: CauseCategoryResource, Name: "oom-killed", Detail: "container exceeded memory limit"}
+	}
+
+	if logTail != nil {
+		if cause, matched := matchCausePatterns(logTail.Content, w.config.CausePatterns); matched {
+			return cause
+		}
+	}
+
+	// 被SIGKILL/SIGTERM结束且存在探针失败事件，说明是存活探针杀掉了容器
+	if container.LastExitCode == 137 || container.LastExitCode == 143 {
+		for _, event := range record.Events {
+			if event.Reason == "Unhealthy" {
+				return ProbableCause{Category: CauseCategoryProbe, Name: "probe-failure", Detail: event.Message}
+			}
+		}
+	}
+
+	return classifyExitCode(container.LastExitCode, container.LastReason)
+}
+
+// 按配置顺序匹配日志特征，返回第一个命中的规则
+func matchCausePatterns(logs string, patterns []config.CausePattern) (ProbableCause, bool) {
+	for _, pattern := range patterns {
+		if match := pattern.Regexp.FindString(logs); match != "" {
+			return ProbableCause{Category: pattern.Category, Name: pattern.Name, Detail: notify.TruncateMessage(match, 120)}, true
+		}
+	}
+	return ProbableCause{}, false
+}
+
+// 按退出码推断原因
+func classifyExitCode(exitCode int32, reason string) ProbableCause {
+	detail := fmt.Sprintf("exit code %d", exitCode)
+	if reason != "" {
+		detail = fmt.Sprintf("exit code %d, reason %s", exitCode, reason)
+	}
+
+	switch exitCode {
+	case 0:
+		return ProbableCause{Category: CauseCategoryApplication, Name: "exited-normally", Detail: detail}
+	case 126, 127:
+		return ProbableCause{Category: CauseCategoryConfig, Name: "command-not-runnable", Detail: detail}
+	case 137:
+		return ProbableCause{Category: CauseCategoryResource, Name: "sigkill", Detail: detail}
+	case 139:
+		return ProbableCause{Category: CauseCategoryApplication, Name: "segmentation-fault", Detail: detail}
+	case 143:
+		return ProbableCause{Category: CauseCategoryApplication, Name: "sigterm", Detail: detail}
+	default:
+		if exitCode > 0 {
+			return ProbableCause{Category: CauseCategoryApplication, Name: "application-error", Detail: detail}
+		}
+		return ProbableCause{Category: CauseCategoryUnknown, Name: "unknown", Detail: detail}
+	}
+}
+
+// 可能原因是否命中跳过回滚的列表，列表项可以是分类或规则名
+func (c ProbableCause) skipsRollback(skipCauses []string) bool {
+	for _, skip := range skipCauses {
+		if skip == c.Category || skip == c.Name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestClassifyCause(t *testing.T) {
+	watcher, _ := newTestWatcher(t, &config.Config{
+		CausePatterns: []config.CausePattern{
+			{Name: "go-panic", Category: CauseCategoryApplication, Regexp: regexp.MustCompile(`panic: .*`)},
+			{Name: "dependency-unreachable", Category: CauseCategoryDependency, Regexp: regexp.MustCompile(`connection refused[^\n]*`)},
+		},
+	})
+	record := func(exitCode int32, reason string, events ...EventSummary) PodRecord {
+		return PodRecord{
+			Restarts:   []RestartEvent{{Container: "app"}},
+			Containers: map[string]ContainerRecord{"app": {Name: "app", LastExitCode: exitCode, LastReason: reason}},
+			Events:     events,
+		}
+	}
+	unhealthy := EventSummary{Reason: "Unhealthy", Message: "Liveness probe failed"}
+
+	tests := []struct {
+		name     string
+		record   PodRecord
+		logs     string
+		wantName string
+	}{
+		{name: "oom killed wins over logs", record: record(137, "OOMKilled"), logs: "panic: boom", wantName: "oom-killed"},
+		{name: "log pattern", record: record(2, "Error"), logs: "starting\npanic: nil map\ngoroutine 1", wantName: "go-panic"},
+		{name: "first configured pattern wins", record: record(1, "Error"), logs: "dial tcp: connection refused\npanic: exit", wantName: "go-panic"},
+		{name: "liveness probe", record: record(137, "Error", unhealthy), wantName: "probe-failure"},
+		{name: "probe event ignored for other exit codes", record: record(1, "Error", unhealthy), wantName: "application-error"},
+		{name: "sigkill without probe failure", record: record(137, "Error"), wantName: "sigkill"},
+		{name: "command not found", record: record(127, "ContainerCannotRun"), wantName: "command-not-runnable"},
+		{name: "no restarts", record: PodRecord{}, wantName: "exited-normally"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logTail *LogTail
+			if tt.logs != "" {
+				logTail = &LogTail{Content: tt.logs}
+			}
+			if cause := watcher.classifyCause(tt.record, logTail); cause.Name != tt.wantName {
+				t.Errorf("classifyCause = %+v, want %s", cause, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestMatchCausePatternsTruncatesOnRuneBoundary(t *testing.T) {
+	patterns := []config.CausePattern{{Name: "missing-env", Category: CauseCategoryConfig, Regexp: regexp.MustCompile(`缺少环境变量.*`)}}
+	cause, matched := matchCausePatterns("缺少环境变量"+strings.Repeat("配置", 100), patterns)
+	if !matched {
+		t.Fatal("pattern not matched")
+	}
+	if len(cause.Detail) > 120 || !utf8.ValidString(cause.Detail) {
+		t.Errorf("detail not truncated on a rune boundary: %d bytes, valid %v", len(cause.Detail), utf8.ValidString(cause.Detail))
+	}
+}
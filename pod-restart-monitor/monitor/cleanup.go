@@ -39,16 +39,25 @@ func (w *PodWatcher) cleanupRecords() {
 	defer w.recordsMu.Unlock()
 
 	now := time.Now()
-	for uid, record := range w.records {
-		if now.Sub(record.LastRestart) > w.config.TimeWindow {
+	for key, record := range w.records {
+		lastActive := record.LastRestart
+		if record.LastFinding.After(lastActive) {
+			lastActive = record.LastFinding
+		}
+		if now.Sub(lastActive) > record.TimeWindow {
 			logrus.WithFields(logrus.Fields{
-				"podName":   record.PodName,
+				"workload":  record.Workload(),
 				"namespace": record.Namespace,
-				"podUID":    uid,
-				"subTime":   now.Sub(record.LastRestart),
-			}).Info("Pod LastRestart time exceeded TimeWindow, deleting record")
-			delete(w.records, uid)
+				"record":    key,
+				"subTime":   now.Sub(lastActive),
+			}).Info("Workload LastRestart time exceeded TimeWindow, deleting record")
+			for podUID := range record.Pods {
+				delete(w.podIndex, podUID)
+			}
+			delete(w.records, key)
 		}
 	}
+	w.cleanupLadders(now)
+	w.events.prune(now)
 	logrus.Debugf("Cleanup records done")
 }
@@ -0,0 +1,103 @@
+package monitor
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"path"
+)
+
+// 容器类型
+const (
+	ContainerTypeApp     = "app"
+	ContainerTypeInit    = "init"
+	ContainerTypeSidecar = "sidecar" // restartPolicy为Always的init容器
+)
+
+// ContainerRecord 工作负载中单个容器的重启记录，同名容器在各副本间合并统计
+type ContainerRecord struct {
+	Name         string
+	Image        string
+	Type         string
+	RestartCount int // 滑动时间窗口内的重启次数
+	LastExitCode int32
+	LastReason   string
+}
+
+// 带类型的容器状态
+type containerStatus struct {
+	v1.ContainerStatus
+	Type string
+}
+
+// 返回Pod中init容器（含sidecar）与普通容器的全部状态
+func podContainerStatuses(pod *v1.Pod) []containerStatus {
+	sidecars := make(map[string]bool)
+	for _, c := range pod.Spec.InitContainers {
+		if c.RestartPolicy != nil && *c.RestartPolicy == v1.ContainerRestartPolicyAlways {
+			sidecars[c.Name] = true
+		}
+	}
+
+	result := make([]containerStatus, 0, len(pod.Status.InitContainerStatuses)+len(pod.Status.ContainerStatuses))
+	for _, cs := range pod.Status.InitContainerStatuses {
+		containerType := ContainerTypeInit
+		if sidecars[cs.Name] {
+			containerType = ContainerTypeSidecar
+		}
+		result = append(result, containerStatus{ContainerStatus: cs, Type: containerType})
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		result = append(result, containerStatus{ContainerStatus: cs, Type: ContainerTypeApp})
+	}
+	return result
+}
+
+// 返回处于CrashLoopBackOff且未被过滤的容器
+func crashLoopingContainers(pod *v1.Pod, policy Policy) []containerStatus {
+	var result []containerStatus
+	for _, cs := range podContainerStatuses(pod) {
+		if !policy.watchesContainer(cs.Name) {
+			continue
+		}
+		if cs.State.Waiting != nil && cs.State.Waiting.Reason == "CrashLoopBackOff" {
+			result = append(result, cs)
+		}
+	}
+	return result
+}
+
+// 根据容器最新状态更新记录中的容器信息
+func (r *PodRecord) updateContainers(pod *v1.Pod, policy Policy) {
+	for _, cs := range podContainerStatuses(pod) {
+		if cs.RestartCount == 0 || !policy.watchesContainer(cs.Name) {
+			continue
+		}
+
+		container := r.Containers[cs.Name]
+		container.Name = cs.Name
+		container.Image = cs.Image
+		container.Type = cs.Type
+		if terminated := cs.LastTerminationState.Terminated; terminated != nil {
+			container.LastExitCode = terminated.ExitCode
+			container.LastReason = terminated.Reason
+		}
+		r.Containers[cs.Name] = container
+	}
+}
+
+// 容器是否在监控范围内，include为空表示全部，exclude优先，支持通配符
+func (p Policy) watchesContainer(name string) bool {
+	for _, pattern := range p.ContainerExclude {
+		if matched, _ := path.Match(pattern, name); matched {
+			return false
+		}
+	}
+	if len(p.ContainerInclude) == 0 {
+		return true
+	}
+	for _, pattern := range p.ContainerInclude {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
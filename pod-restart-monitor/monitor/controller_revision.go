@@ -0,0 +1,61 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sort"
+)
+
+// 获取属于指定控制器（StatefulSet/DaemonSet）的ControllerRevision，按版本号降序
+func getOwnedControllerRevisions(client kubernetes.Interface, namespace string, selector *metav1.LabelSelector, ownerUID types.UID) ([]appsv1.ControllerRevision, error) {
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+
+	list, err := client.AppsV1().ControllerRevisions(namespace).List(
+		context.TODO(),
+		metav1.ListOptions{LabelSelector: labelSelector.String()},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list controller revisions failed: %w", err)
+	}
+
+	var result []appsv1.ControllerRevision
+	for _, rev := range list.Items {
+		if ref := metav1.GetControllerOf(&rev); ref != nil && ref.UID == ownerUID {
+			result = append(result, rev)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Revision > result[j].Revision
+	})
+	return result, nil
+}
+
+// 查找当前版本之前的最近一个版本，跳过本轮已回滚掉的版本；恢复的版本沿用原ControllerRevision名称，按名称识别
+func findPreviousControllerRevision(revisions []appsv1.ControllerRevision, currentName string, opts RollbackOptions) (*appsv1.ControllerRevision, *appsv1.ControllerRevision, error) {
+	if len(revisions) < 2 {
+		return nil, nil, fmt.Errorf("not enough revision history (need at least 2, got %d)", len(revisions))
+	}
+
+	// 未指定当前版本时取最新版本
+	current := &revisions[0]
+	for i := range revisions {
+		if revisions[i].Name == currentName {
+			current = &revisions[i]
+			break
+		}
+	}
+
+	for i := range revisions {
+		if revisions[i].Revision < current.Revision && !opts.skips(schemeControllerRevision, revisions[i].Name) {
+			return current, &revisions[i], nil
+		}
+	}
+	return current, nil, fmt.Errorf("no revision older than %d available", current.Revision)
+}
@@ -0,0 +1,90 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// 回滚DaemonSet到上一个ControllerRevision
+func rollbackDaemonSet(name string, pod *v1.Pod, client kubernetes.Interface, opts RollbackOptions) (*RollbackResult, error) {
+	ds, err := client.AppsV1().DaemonSets(pod.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daemonset: %w", err)
+	}
+
+	revisions, err := getOwnedControllerRevisions(client, ds.Namespace, ds.Spec.Selector, ds.UID)
+	if err != nil {
+		return nil, err
+	}
+	// DaemonSet的当前版本总是版本号最大的ControllerRevision
+	current, target, err := findPreviousControllerRevision(revisions, "", opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// 崩溃的Pod运行的不是最新版本，说明问题不是新版本引入的
+	podHash := pod.Labels[appsv1.DefaultDaemonSetUniqueLabelKey]
+	if currentHash := current.Labels[appsv1.DefaultDaemonSetUniqueLabelKey]; podHash != "" && currentHash != "" && podHash != currentHash {
+		return nil, fmt.Errorf("pod %s runs revision %s, not the current revision %s", pod.Name, podHash, currentHash)
+	}
+
+	if err := opts.checkTarget(schemeControllerRevision, target.Name, target.Revision); err != nil {
+		return nil, err
+	}
+
+	// 补丁携带resourceVersion，期间DaemonSet被修改时返回冲突，重试时重新读取
+	var patched *appsv1.DaemonSet
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest, err := client.AppsV1().DaemonSets(ds.Namespace).Get(context.TODO(), ds.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		// 期间有新的发布时放弃回滚，避免覆盖他人的变更
+		if latest.Generation != ds.Generation {
+			return fmt.Errorf("daemonset generation changed from %d to %d during rollback", ds.Generation, latest.Generation)
+		}
+		patch, err := withRollbackAnnotations(target.Data.Raw, latest.ResourceVersion, current.Revision, target.Revision)
+		if err != nil {
+			return err
+		}
+		patched, err = client.AppsV1().DaemonSets(ds.Namespace).Patch(
+			context.TODO(),
+			ds.Name,
+			types.StrategicMergePatchType,
+			patch,
+			metav1.PatchOptions{DryRun: dryRunOption(opts.DryRun)},
+		)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to patch daemonset: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"daemonset":    ds.Name,
+		"namespace":    ds.Namespace,
+		"fromRevision": current.Revision,
+		"toRevision":   target.Revision,
+		"dryRun":       opts.DryRun,
+	}).Info("DaemonSet template restored")
+
+	return &RollbackResult{
+		Kind:         "DaemonSet",
+		Name:         ds.Name,
+		Namespace:    ds.Namespace,
+		FromRevision: current.Revision,
+		ToRevision:   target.Revision,
+		DryRun:       opts.DryRun,
+		Generation:   patched.Generation,
+		Diff:         templateDiff(ds.Spec.Template, patched.Spec.Template),
+		Scheme:       schemeControllerRevision,
+		FromVersion:  current.Name,
+	}, nil
+}
@@ -0,0 +1,264 @@
+package monitor
+
+import (
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	"time"
+)
+
+// Finding 检测器发现的一次异常
+type Finding struct {
+	Detector  string
+	Key       string // 去重标识，同一Key在持续存在期间只统计一次
+	PodName   string
+	Container string // Pod级别的异常为空
+	Detail    string
+	Time      time.Time
+}
+
+// Detector CrashLoopBackOff之外的异常检测器
+type Detector interface {
+	Name() string
+	// Rollbackable 该类异常是否可能由新版本引入，可以通过回滚解决
+	Rollbackable() bool
+	Detect(pod *v1.Pod, now time.Time) []Finding
+}
+
+// 按配置创建启用的检测器
+func newDetectors(cfg *config.Config) []Detector {
+	all := []Detector{
+		&oomKilledDetector{},
+		&waitingReasonDetector{
+			name:         config.DetectorImagePull,
+			reasons:      []string{"ImagePullBackOff", "ErrImagePull", "InvalidImageName"},
+			rollbackable: true,
+		},
+		&waitingReasonDetector{
+			name:         config.DetectorCreateContainerConfigError,
+			reasons:      []string{"CreateContainerConfigError"},
+			rollbackable: true,
+		},
+		&waitingReasonDetector{
+			name:         config.DetectorRunContainerError,
+			reasons:      []string{"RunContainerError"},
+			rollbackable: true,
+		},
+		&evictedDetector{},
+		&pendingDetector{timeout: cfg.PendingTimeout},
+	}
+
+	var result []Detector
+	for _, detector := range all {
+		if cfg.Detectors[detector.Name()].Enabled {
+			result = append(result, detector)
+		}
+	}
+	return result
+}
+
+// 容器因内存超限被杀
+type oomKilledDetector struct{}
+
+func (d *oomKilledDetector) Name() string       { return config.DetectorOOMKilled }
+func (d *oomKilledDetector) Rollbackable() bool { return false }
+
+func (d *oomKilledDetector) Detect(pod *v1.Pod, now time.Time) []Finding {
+	var result []Finding
+	for _, cs := range podContainerStatuses(pod) {
+		// 已重启的容器看上次终止状态，restartPolicy为Never的容器看当前状态
+		for _, terminated := range []*v1.ContainerStateTerminated{cs.LastTerminationState.Terminated, cs.State.Terminated} {
+			if terminated == nil || terminated.Reason != "OOMKilled" {
+				continue
+			}
+			result = append(result, Finding{
+				Detector:  d.Name(),
+				Key:       fmt.Sprintf("%s/%s/%d", d.Name(), cs.Name, terminated.FinishedAt.Unix()),
+				PodName:   pod.Name,
+				Container: cs.Name,
+				Detail:    fmt.Sprintf("exit code %d", terminated.ExitCode),
+				Time:      terminatedAt(terminated, now),
+			})
+		}
+	}
+	return result
+}
+
+func terminatedAt(terminated *v1.ContainerStateTerminated, now time.Time) time.Time {
+	if terminated.FinishedAt.IsZero() {
+		return now
+	}
+	return terminated.FinishedAt.Time
+}
+
+// 容器处于指定的Waiting状态
+type waitingReasonDetector struct {
+	name         string
+	reasons      []string
+	rollbackable bool
+}
+
+func (d *waitingReasonDetector) Name() string       { return d.name }
+func (d *waitingReasonDetector) Rollbackable() bool { return d.rollbackable }
+
+func (d *waitingReasonDetector) Detect(pod *v1.Pod, now time.Time) []Finding {
+	var result []Finding
+	for _, cs := range podContainerStatuses(pod) {
+		if cs.State.Waiting == nil || !containsString(d.reasons, cs.State.Waiting.Reason) {
+			continue
+		}
+		result = append(result, Finding{
+			Detector:  d.name,
+			Key:       d.name + "/" + cs.Name,
+			PodName:   pod.Name,
+			Container: cs.Name,
+			Detail:    fmt.Sprintf("%s: %s", cs.State.Waiting.Reason, cs.State.Waiting.Message),
+			Time:      now,
+		})
+	}
+	return result
+}
+
+// Pod被驱逐
+type evictedDetector struct{}
+
+func (d *evictedDetector) Name() string       { return config.DetectorEvicted }
+func (d *evictedDetector) Rollbackable() bool { return false }
+
+func (d *evictedDetector) Detect(pod *v1.Pod, now time.Time) []Finding {
+	if pod.Status.Phase != v1.PodFailed || pod.Status.Reason != "Evicted" {
+		return nil
+	}
+	return []Finding{{
+		Detector: d.Name(),
+		Key:      d.Name(),
+		PodName:  pod.Name,
+		Detail:   fmt.Sprintf("%s on node %s", pod.Status.Message, pod.Spec.NodeName),
+		Time:     now,
+	}}
+}
+
+// Pod长时间处于Pending，依赖informer的周期性resync在无状态变化时也能检测到
+type pendingDetector struct {
+	timeout time.Duration
+}
+
+func (d *pendingDetector) Name() string       { return config.DetectorPending }
+func (d *pendingDetector) Rollbackable() bool { return false }
+
+func (d *pendingDetector) Detect(pod *v1.Pod, now time.Time) []Finding {
+	if pod.Status.Phase != v1.PodPending || now.Sub(pod.CreationTimestamp.Time) < d.timeout {
+		return nil
+	}
+	return []Finding{{
+		Detector: d.Name(),
+		Key:      d.Name(),
+		PodName:  pod.Name,
+		Detail:   pendingReason(pod),
+		Time:     now,
+	}}
+}
+
+// Pending原因: 优先取调度失败信息，其次取容器的Waiting原因
+func pendingReason(pod *v1.Pod) string {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse {
+			return fmt.Sprintf("%s: %s", condition.Reason, condition.Message)
+		}
+	}
+	for _, cs := range podContainerStatuses(pod) {
+		if cs.State.Waiting != nil {
+			return fmt.Sprintf("container %s waiting: %s", cs.Name, cs.State.Waiting.Reason)
+		}
+	}
+	return "unknown"
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// 运行所有检测器，返回此前未出现过的异常，并记录当前仍存在的异常
+func (w *PodWatcher) newFindings(pod *v1.Pod, now time.Time) []Finding {
+	var current []Finding
+	for _, detector := range w.detectors {
+		current = append(current, detector.Detect(pod, now)...)
+	}
+
+	w.recordsMu.Lock()
+	defer w.recordsMu.Unlock()
+
+	podUID := string(pod.UID)
+	previous := w.activeFindings[podUID]
+	if len(current) == 0 {
+		delete(w.activeFindings, podUID)
+		return nil
+	}
+
+	active := make(map[string]bool, len(current))
+	var result []Finding
+	for _, finding := range current {
+		active[finding.Key] = true
+		if !previous[finding.Key] {
+			result = append(result, finding)
+		}
+	}
+	w.activeFindings[podUID] = active
+	return result
+}
+
+// 把异常加入工作负载记录，返回达到阈值的检测器及其窗口内的异常
+func (w *PodWatcher) recordFindings(key string, pod *v1.Pod, workload *Workload, policy Policy, findings []Finding, now time.Time) map[string][]Finding {
+	w.recordsMu.Lock()
+	defer w.recordsMu.Unlock()
+
+	record, exists := w.records[key]
+	if !exists {
+		record = w.createNewRecord(pod, workload, now)
+		logNewRecord(pod, key, now)
+	}
+	record.TimeWindow = policy.TimeWindow
+	if workload != nil {
+		record.Replicas = workload.Replicas
+	}
+
+	reached := make(map[string][]Finding)
+	for _, finding := range findings {
+		if finding.Container != "" && !policy.watchesContainer(finding.Container) {
+			continue
+		}
+
+		var inWindow []Finding
+		for _, f := range append(record.Findings[finding.Detector], finding) {
+			if now.Sub(f.Time) <= record.TimeWindow {
+				inWindow = append(inWindow, f)
+			}
+		}
+		record.Findings[finding.Detector] = inWindow
+		record.LastFinding = now
+
+		if len(inWindow) >= w.config.Detectors[finding.Detector].Threshold {
+			reached[finding.Detector] = inWindow
+			delete(record.Findings, finding.Detector)
+		}
+	}
+
+	record.Events = mergeEvents(record.Events, w.events.Recent(string(pod.UID)), maxEventsPerRecord)
+	w.records[key] = record
+	w.podIndex[string(pod.UID)] = key
+	return reached
+}
+
+func (w *PodWatcher) detectorByName(name string) Detector {
+	for _, detector := range w.detectors {
+		if detector.Name() == name {
+			return detector
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+// 以YAML逐行比较两个Pod模板，只输出变化的行（"-"为回滚前，"+"为回滚后）
+func templateDiff(from, to v1.PodTemplateSpec) string {
+	fromYAML, err := yaml.Marshal(from)
+	if err != nil {
+		return "failed to render template: " + err.Error()
+	}
+	toYAML, err := yaml.Marshal(to)
+	if err != nil {
+		return "failed to render template: " + err.Error()
+	}
+	return lineDiff(
+		strings.Split(strings.TrimRight(string(fromYAML), "\n"), "\n"),
+		strings.Split(strings.TrimRight(string(toYAML), "\n"), "\n"),
+	)
+}
+
+// 基于最长公共子序列的行级差异
+func lineDiff(a, b []string) string {
+	// lcs[i][j] 为 a[i:] 与 b[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, "+ "+b[j])
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,44 @@
+package monitor
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"strings"
+	"testing"
+)
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want string
+	}{
+		{name: "identical", a: []string{"a", "b"}, b: []string{"a", "b"}, want: ""},
+		{name: "changed line", a: []string{"a", "b", "c"}, b: []string{"a", "x", "c"}, want: "- b\n+ x"},
+		{name: "added lines", a: []string{"a"}, b: []string{"a", "b", "c"}, want: "+ b\n+ c"},
+		{name: "removed lines", a: []string{"a", "b", "c"}, b: []string{"c"}, want: "- a\n- b"},
+		{name: "empty", a: nil, b: []string{"a"}, want: "+ a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lineDiff(tt.a, tt.b); got != tt.want {
+				t.Errorf("lineDiff = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateDiff(t *testing.T) {
+	template := func(image string) v1.PodTemplateSpec {
+		return v1.PodTemplateSpec{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: image}}}}
+	}
+	diff := templateDiff(template("web:v2"), template("web:v1"))
+	if !strings.Contains(diff, "- ") || !strings.Contains(diff, "image: web:v2") || !strings.Contains(diff, "+ ") || !strings.Contains(diff, "image: web:v1") {
+		t.Errorf("unexpected diff %q", diff)
+	}
+	if strings.Contains(diff, "name: app") {
+		t.Errorf("unchanged lines in diff %q", diff)
+	}
+	if diff := templateDiff(template("web:v1"), template("web:v1")); diff != "" {
+		t.Errorf("expected no diff, got %q", diff)
+	}
+}
@@ -0,0 +1,152 @@
+package monitor
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// 每个Pod最多保留的事件数
+	maxEventsPerPod = 10
+	// 每条记录最多附带的事件数
+	maxEventsPerRecord = 10
+	// 事件在索引中保留的时长
+	eventRetention = time.Hour
+)
+
+// EventSummary 与Pod关联的core/v1 Event摘要
+type EventSummary struct {
+	UID     string
+	PodName string
+	Type    string
+	Reason  string
+	Message string
+	Count   int32
+	Time    time.Time
+}
+
+// EventIndex 按involvedObject UID索引Pod的近期事件
+type EventIndex struct {
+	reasons map[string]bool
+	events  map[string][]EventSummary
+	mu      sync.RWMutex
+}
+
+func NewEventIndex(reasons []string) *EventIndex {
+	reasonSet := make(map[string]bool, len(reasons))
+	for _, reason := range reasons {
+		reasonSet[reason] = true
+	}
+	return &EventIndex{
+		reasons: reasonSet,
+		events:  make(map[string][]EventSummary),
+	}
+}
+
+// Add 记录一条Pod事件，同一事件更新时替换旧值
+func (idx *EventIndex) Add(event *v1.Event) {
+	if event.InvolvedObject.Kind != "Pod" || !idx.reasons[event.Reason] {
+		return
+	}
+
+	summary := EventSummary{
+		UID:     string(event.UID),
+		PodName: event.InvolvedObject.Name,
+		Type:    event.Type,
+		Reason:  event.Reason,
+		Message: event.Message,
+		Count:   event.Count,
+		Time:    eventTime(event),
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	podUID := string(event.InvolvedObject.UID)
+	list := idx.events[podUID]
+	replaced := false
+	for i := range list {
+		if list[i].UID == summary.UID {
+			list[i] = summary
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		list = append(list, summary)
+	}
+	idx.events[podUID] = latestEvents(list, maxEventsPerPod)
+}
+
+// Recent 返回Pod的近期事件，按时间升序
+func (idx *EventIndex) Recent(podUID string) []EventSummary {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return append([]EventSummary(nil), idx.events[podUID]...)
+}
+
+// Delete 删除Pod的全部事件
+func (idx *EventIndex) Delete(podUID string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	delete(idx.events, podUID)
+}
+
+// 清理超过保留时长的事件
+func (idx *EventIndex) prune(now time.Time) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for podUID, list := range idx.events {
+		var kept []EventSummary
+		for _, event := range list {
+			if now.Sub(event.Time) <= eventRetention {
+				kept = append(kept, event)
+			}
+		}
+		if len(kept) == 0 {
+			delete(idx.events, podUID)
+		} else {
+			idx.events[podUID] = kept
+		}
+	}
+}
+
+// 事件发生时间，依次取LastTimestamp、EventTime、FirstTimestamp与创建时间
+func eventTime(event *v1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	case !event.FirstTimestamp.IsZero():
+		return event.FirstTimestamp.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
+
+// 合并事件，按UID去重后保留最近的limit条
+func mergeEvents(current []EventSummary, added []EventSummary, limit int) []EventSummary {
+	byUID := make(map[string]EventSummary, len(current)+len(added))
+	for _, event := range append(current, added...) {
+		byUID[event.UID] = event
+	}
+	merged := make([]EventSummary, 0, len(byUID))
+	for _, event := range byUID {
+		merged = append(merged, event)
+	}
+	return latestEvents(merged, limit)
+}
+
+func latestEvents(list []EventSummary, limit int) []EventSummary {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+	if len(list) > limit {
+		list = list[len(list)-limit:]
+	}
+	return list
+}
@@ -0,0 +1,317 @@
+package monitor
+
+import (
+	"context"
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"strings"
+)
+
+// GitOps控制器写在其管理的资源上的标签与注解
+const (
+	LabelArgoCDInstance        = "argocd.argoproj.io/instance"
+	AnnotationArgoCDTrackingID = "argocd.argoproj.io/tracking-id"
+	LabelFluxKustomizeName     = "kustomize.toolkit.fluxcd.io/name"
+	LabelFluxKustomizeNS       = "kustomize.toolkit.fluxcd.io/namespace"
+)
+
+// 暂停Argo CD自动同步时保存原自动同步配置的注解，恢复时写回 spec.syncPolicy.automated
+const AnnotationSuspendedAutomated = "podsentry.io/suspended-automated"
+
+var (
+	argoApplicationResource   = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
+	fluxKustomizationResource = schema.GroupVersionResource{Group: "kustomize.toolkit.fluxcd.io", Version: "v1", Resource: "kustomizations"}
+)
+
+// Argo CD应用历史按Git版本记录本轮回滚掉的版本，历史ID与工作负载版本号无关
+const schemeArgoCD = "argocd"
+
+// 工作负载由GitOps控制器管理，按配置只通知不回滚
+var errGitOpsManaged = errors.New("workload is managed by gitops")
+
+// gitOpsOwner 管理工作负载的Argo CD Application或Flux Kustomization
+type gitOpsOwner struct {
+	Kind      string // Application 或 Kustomization
+	Name      string
+	Namespace string
+}
+
+func (o *gitOpsOwner) String() string {
+	if o.Kind == "Application" {
+		return fmt.Sprintf("Argo CD application %s/%s", o.Namespace, o.Name)
+	}
+	return fmt.Sprintf("Flux kustomization %s/%s", o.Namespace, o.Name)
+}
+
+func (o *gitOpsOwner) resource() schema.GroupVersionResource {
+	if o.Kind == "Application" {
+		return argoApplicationResource
+	}
+	return fluxKustomizationResource
+}
+
+// 根据标签与注解识别GitOps控制器，非GitOps管理时返回nil
+func gitOpsOwnerOf(meta *metav1.ObjectMeta, argoCDNamespace string) *gitOpsOwner {
+	if name := meta.Labels[LabelFluxKustomizeName]; name != "" {
+		namespace := meta.Labels[LabelFluxKustomizeNS]
+		if namespace == "" {
+			namespace = meta.Namespace
+		}
+		return &gitOpsOwner{Kind: "Kustomization", Name: name, Namespace: namespace}
+	}
+
+	// tracking-id 格式为 <应用>:<group>/<kind>:<命名空间>/<名称>，任意命名空间中的应用为 <命名空间>_<应用>
+	app := meta.Labels[LabelArgoCDInstance]
+	if trackingID := meta.Annotations[AnnotationArgoCDTrackingID]; trackingID != "" {
+		app = strings.SplitN(trackingID, ":", 2)[0]
+	}
+	if app == "" {
+		return nil
+	}
+	namespace := argoCDNamespace
+	if parts := strings.SplitN(app, "_", 2); len(parts) == 2 {
+		namespace, app = parts[0], parts[1]
+	}
+	return &gitOpsOwner{Kind: "Application", Name: app, Namespace: namespace}
+}
+
+// 按 GITOPS_STRATEGY 处理GitOps管理的工作负载，返回true表示回滚已完成，不再进行模板回滚
+func (w *PodWatcher) rollbackGitOps(owner *gitOpsOwner, record PodRecord, meta *metav1.ObjectMeta, opts RollbackOptions) (*RollbackResult, string, bool, error) {
+	if w.dynamic == nil {
+		return nil, "", false, errors.New("dynamic client is not configured for gitops")
+	}
+	obj, err := w.dynamic.Resource(owner.resource()).Namespace(owner.Namespace).Get(context.TODO(), owner.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", false, fmt.Errorf("failed to get %s: %w", owner, err)
+	}
+
+	switch {
+	case w.config.GitOpsStrategy == config.GitOpsArgoCDRollback && owner.Kind == "Application":
+		result, err := w.rollbackArgoApplication(owner, obj, record, meta, opts)
+		return result, "", true, err
+	case w.config.GitOpsStrategy == config.GitOpsSuspend || w.config.GitOpsStrategy == config.GitOpsArgoCDRollback:
+		// Flux没有应用历史，暂停调谐后按模板回滚
+		note, err := w.suspendGitOps(owner, obj, opts.DryRun)
+		return nil, note, false, err
+	}
+
+	// 回滚会被GitOps控制器立即恢复，只通知需要在Git中回退的版本
+	revision := gitOpsRevision(owner, obj)
+	return nil, "", false, fmt.Errorf("%w: %s belongs to %s at revision %s, revert it in Git",
+		errGitOpsManaged, record.Workload(), owner, revision)
+}
+
+// 当前同步或应用的Git版本
+func gitOpsRevision(owner *gitOpsOwner, obj *unstructured.Unstructured) string {
+	var revision string
+	if owner.Kind == "Application" {
+		revision, _, _ = unstructured.NestedString(obj.Object, "status", "sync", "revision")
+	} else {
+		revision, _, _ = unstructured.NestedString(obj.Object, "status", "lastAppliedRevision")
+	}
+	if revision == "" {
+		return "unknown"
+	}
+	return revision
+}
+
+// 暂停Argo CD自动同步或Flux调谐，避免回滚被立即恢复
+func (w *PodWatcher) suspendGitOps(owner *gitOpsOwner, obj *unstructured.Unstructured, dryRun bool) (string, error) {
+	var patch map[string]interface{}
+	var note string
+	if owner.Kind == "Application" {
+		automated, found, _ := unstructured.NestedMap(obj.Object, "spec", "syncPolicy", "automated")
+		if !found {
+			return fmt.Sprintf("%s auto-sync is already disabled", owner), nil
+		}
+		saved, err := json.Marshal(automated)
+		if err != nil {
+			return "", err
+		}
+		patch = map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{AnnotationSuspendedAutomated: string(saved)},
+			},
+			"spec": map[string]interface{}{
+				"syncPolicy": map[string]interface{}{"automated": nil},
+			},
+		}
+		note = fmt.Sprintf("%s auto-sync disabled, revert the change in Git and restore spec.syncPolicy.automated from annotation %s",
+			owner, AnnotationSuspendedAutomated)
+	} else {
+		if suspended, _, _ := unstructured.NestedBool(obj.Object, "spec", "suspend"); suspended {
+			return fmt.Sprintf("%s is already suspended", owner), nil
+		}
+		patch = map[string]interface{}{
+			"spec": map[string]interface{}{"suspend": true},
+		}
+		note = fmt.Sprintf("%s suspended, revert the change in Git then run: flux resume kustomization %s -n %s",
+			owner, owner.Name, owner.Namespace)
+	}
+
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return "", err
+	}
+	_, err = w.dynamic.Resource(owner.resource()).Namespace(owner.Namespace).Patch(
+		context.TODO(), owner.Name, types.MergePatchType, data, metav1.PatchOptions{DryRun: dryRunOption(dryRun)})
+	if err != nil {
+		return "", fmt.Errorf("failed to suspend %s: %w", owner, err)
+	}
+	logrus.WithFields(logrus.Fields{
+		"owner":  owner.String(),
+		"dryRun": dryRun,
+	}).Info("GitOps reconciliation suspended")
+	return note, nil
+}
+
+// 与 argocd app rollback 一致: 关闭自动同步，然后发起同步到历史版本的操作
+func (w *PodWatcher) rollbackArgoApplication(owner *gitOpsOwner, obj *unstructured.Unstructured, record PodRecord, meta *metav1.ObjectMeta, opts RollbackOptions) (*RollbackResult, error) {
+	if phase, _, _ := unstructured.NestedString(obj.Object, "status", "operationState", "phase"); phase == "Running" {
+		return nil, fmt.Errorf("%s has an operation in progress", owner)
+	}
+	history, _, _ := unstructured.NestedSlice(obj.Object, "status", "history")
+	current, target, err := argoRollbackTarget(history, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", owner, err)
+	}
+	currentID, _, _ := unstructured.NestedInt64(current, "id")
+	targetID, _, _ := unstructured.NestedInt64(target, "id")
+	if err := opts.checkTarget(schemeArgoCD, argoHistoryRevision(target), targetID); err != nil {
+		return nil, err
+	}
+
+	note, err := w.suspendGitOps(owner, obj, opts.DryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	sync := map[string]interface{}{}
+	if sources, found, _ := unstructured.NestedSlice(target, "sources"); found {
+		revisions, _, _ := unstructured.NestedStringSlice(target, "revisions")
+		sync["sources"] = sources
+		sync["revisions"] = revisions
+	} else {
+		revision, _, _ := unstructured.NestedString(target, "revision")
+		source, _, _ := unstructured.NestedMap(target, "source")
+		sync["revision"] = revision
+		sync["source"] = source
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"operation": map[string]interface{}{
+			"initiatedBy": map[string]interface{}{"username": "podsentry"},
+			"sync":        sync,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.dynamic.Resource(owner.resource()).Namespace(owner.Namespace).Patch(
+		context.TODO(), owner.Name, types.MergePatchType, patch, metav1.PatchOptions{DryRun: dryRunOption(opts.DryRun)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to roll back %s: %w", owner, err)
+	}
+
+	revision, _, _ := unstructured.NestedString(target, "revision")
+	logrus.WithFields(logrus.Fields{
+		"owner":    owner.String(),
+		"from":     currentID,
+		"to":       targetID,
+		"revision": revision,
+		"dryRun":   opts.DryRun,
+	}).Info("Argo CD application rollback requested")
+	return &RollbackResult{
+		Kind:         record.WorkloadKind,
+		Name:         record.WorkloadName,
+		Namespace:    record.Namespace,
+		FromRevision: currentID,
+		ToRevision:   targetID,
+		DryRun:       opts.DryRun,
+		// 同步由Argo CD异步执行，先确认应用同步完成，再按工作负载当时的generation确认滚动
+		Generation:  meta.Generation,
+		Owner:       owner.String(),
+		Scheme:      schemeArgoCD,
+		FromVersion: argoHistoryRevision(current),
+		ToVersion:   argoHistoryRevision(target),
+		GitOps:      owner,
+		Note:        fmt.Sprintf("syncing to history %d revision %s; %s", targetID, revision, note),
+	}, nil
+}
+
+// 获取Argo CD应用的同步状态，返回true表示已同步到回滚目标版本
+func argoSyncStatus(ctx context.Context, dynamicClient dynamic.Interface, result *RollbackResult) (RolloutStatus, bool, error) {
+	owner := result.GitOps
+	if dynamicClient == nil {
+		return RolloutStatus{}, false, errors.New("dynamic client is not configured for gitops")
+	}
+	app, err := dynamicClient.Resource(owner.resource()).Namespace(owner.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+	if err != nil {
+		return RolloutStatus{}, false, fmt.Errorf("failed to get %s: %w", owner, err)
+	}
+	status, synced := argoApplicationSyncStatus(app, result.ToVersion)
+	return status, synced, nil
+}
+
+// 按 status.operationState 判断发起的同步操作：版本一致且成功后才检查工作负载
+func argoApplicationSyncStatus(app *unstructured.Unstructured, revision string) (RolloutStatus, bool) {
+	operation, _, _ := unstructured.NestedMap(app.Object, "status", "operationState", "operation", "sync")
+	phase, _, _ := unstructured.NestedString(app.Object, "status", "operationState", "phase")
+	if argoHistoryRevision(operation) != revision {
+		return RolloutStatus{Progress: "waiting for Argo CD to start syncing revision " + revision}, false
+	}
+	progress := fmt.Sprintf("Argo CD sync to revision %s %s", revision, phase)
+	switch phase {
+	case "Succeeded":
+		return RolloutStatus{Progress: progress}, true
+	case "Failed", "Error":
+		message, _, _ := unstructured.NestedString(app.Object, "status", "operationState", "message")
+		return RolloutStatus{Failed: message, Progress: progress}, false
+	}
+	return RolloutStatus{Progress: progress}, false
+}
+
+// 回滚目标为当前内容首次部署之前、Git版本不同的最近一次部署，避免回滚到刚被回滚掉的版本；同时跳过本轮已回滚掉的版本
+func argoRollbackTarget(history []interface{}, opts RollbackOptions) (map[string]interface{}, map[string]interface{}, error) {
+	var entries []map[string]interface{}
+	for _, item := range history {
+		if entry, ok := item.(map[string]interface{}); ok {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, nil, errors.New("no deployment history")
+	}
+	current := entries[len(entries)-1]
+	revision := argoHistoryRevision(current)
+
+	first := len(entries) - 1
+	for i := range entries {
+		if argoHistoryRevision(entries[i]) == revision {
+			first = i
+			break
+		}
+	}
+	for i := first - 1; i >= 0; i-- {
+		if previous := argoHistoryRevision(entries[i]); previous != revision && !opts.skips(schemeArgoCD, previous) {
+			return current, entries[i], nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no previous revision to roll back to from %s", revision)
+}
+
+// 多源应用的历史记录使用revisions
+func argoHistoryRevision(entry map[string]interface{}) string {
+	if revisions, found, _ := unstructured.NestedStringSlice(entry, "revisions"); found {
+		return strings.Join(revisions, ",")
+	}
+	revision, _, _ := unstructured.NestedString(entry, "revision")
+	return revision
+}
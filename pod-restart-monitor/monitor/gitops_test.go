@@ -0,0 +1,94 @@
+package monitor
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"testing"
+)
+
+func argoHistory(revisions ...string) []interface{} {
+	var history []interface{}
+	for i, revision := range revisions {
+		history = append(history, map[string]interface{}{"id": int64(i), "revision": revision})
+	}
+	return history
+}
+
+func TestArgoRollbackTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		history []interface{}
+		opts    RollbackOptions
+		want    string // 为空表示期望出错
+	}{
+		{name: "previous revision", history: argoHistory("a", "b", "c"), want: "b"},
+		// 同一版本多次同步时回滚到该版本首次部署之前
+		{name: "repeated syncs of the current revision", history: argoHistory("a", "b", "c", "c"), want: "b"},
+		// 当前的b是从c回滚得到的，再次回滚时回到b首次部署之前的a，而不是刚被回滚掉的c
+		{name: "current revision is a rollback", history: argoHistory("a", "b", "c", "b"), want: "a"},
+		{name: "skips rolled back revisions", history: argoHistory("a", "b", "c"), opts: RollbackOptions{Scheme: schemeArgoCD, RolledBackFrom: []string{"b"}}, want: "a"},
+		{name: "no previous revision", history: argoHistory("a", "a")},
+		{name: "no history"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, target, err := argoRollbackTarget(tt.history, tt.opts)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("expected error, got target %v", target)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if argoHistoryRevision(target) != tt.want {
+				t.Errorf("target = %s, want %s", argoHistoryRevision(target), tt.want)
+			}
+			if current["id"] != int64(len(tt.history)-1) {
+				t.Errorf("current = %v, want the latest history entry", current)
+			}
+		})
+	}
+}
+
+func TestArgoHistoryRevisionMultiSource(t *testing.T) {
+	entry := map[string]interface{}{"revisions": []interface{}{"a1", "b1"}, "revision": ""}
+	if revision := argoHistoryRevision(entry); revision != "a1,b1" {
+		t.Errorf("revision = %q, want a1,b1", revision)
+	}
+}
+
+func TestArgoApplicationSyncStatus(t *testing.T) {
+	app := func(revision, phase string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"status": map[string]interface{}{
+				"operationState": map[string]interface{}{
+					"phase":     phase,
+					"message":   "one or more objects failed to apply",
+					"operation": map[string]interface{}{"sync": map[string]interface{}{"revision": revision}},
+				},
+			},
+		}}
+	}
+
+	tests := []struct {
+		name       string
+		app        *unstructured.Unstructured
+		wantSynced bool
+		wantFailed bool
+	}{
+		{name: "operation not started", app: &unstructured.Unstructured{Object: map[string]interface{}{}}},
+		{name: "previous operation", app: app("c", "Succeeded")},
+		{name: "running", app: app("b", "Running")},
+		{name: "succeeded", app: app("b", "Succeeded"), wantSynced: true},
+		{name: "failed", app: app("b", "Failed"), wantFailed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, synced := argoApplicationSyncStatus(tt.app, "b")
+			if synced != tt.wantSynced || (status.Failed != "") != tt.wantFailed {
+				t.Errorf("status = %+v, synced %v", status, synced)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package monitor
+
+import (
+	"context"
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// kill switch ConfigMap中的键: disabled 为 true 时停止所有自动处置，reason 写入通知
+const (
+	KillSwitchDisabledKey = "disabled"
+	KillSwitchReasonKey   = "reason"
+)
+
+// killSwitch 由ConfigMap informer实时更新
+type killSwitch struct {
+	mu       sync.RWMutex
+	disabled bool
+	reason   string
+}
+
+func (k *killSwitch) set(cm *v1.ConfigMap) {
+	disabled, reason := false, ""
+	if cm != nil {
+		disabled, _ = strconv.ParseBool(cm.Data[KillSwitchDisabledKey])
+		reason = cm.Data[KillSwitchReasonKey]
+	}
+
+	k.mu.Lock()
+	changed := k.disabled != disabled
+	k.disabled, k.reason = disabled, reason
+	k.mu.Unlock()
+	if changed {
+		logrus.WithFields(logrus.Fields{
+			"disabled": disabled,
+			"reason":   reason,
+		}).Warn("Kill switch changed")
+	}
+}
+
+func (k *killSwitch) get() (bool, string) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.disabled, k.reason
+}
+
+// StartKillSwitch 监听kill switch ConfigMap，等待首次同步后返回；ConfigMap不存在时不限制
+func StartKillSwitch(ctx context.Context, client kubernetes.Interface, watcher *PodWatcher, cfg *config.Config) error {
+	namespace, name := cfg.Guardrails.KillSwitchNamespace, cfg.Guardrails.KillSwitchName
+	if name == "" {
+		return nil
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(client, cfg.ResyncPeriod,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}))
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if cm, ok := obj.(*v1.ConfigMap); ok {
+				watcher.killSwitch.set(cm)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if cm, ok := newObj.(*v1.ConfigMap); ok {
+				watcher.killSwitch.set(cm)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			watcher.killSwitch.set(nil)
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to add kill switch event handler: %w", err)
+	}
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("failed to sync kill switch configmap %s/%s", namespace, name)
+	}
+	logrus.WithFields(logrus.Fields{
+		"configmap": namespace + "/" + name,
+	}).Info("Kill switch watching")
+	return nil
+}
+
+// 检查是否允许对命名空间执行自动处置，返回不允许的原因；在执行前检查，审批通过后同样重新检查
+func (w *PodWatcher) guardrailReason(namespace string, now time.Time) string {
+	guardrails := w.config.Guardrails
+	if disabled, reason := w.killSwitch.get(); disabled {
+		if reason == "" {
+			reason = "no reason given"
+		}
+		return fmt.Sprintf("kill switch %s/%s is on: %s", guardrails.KillSwitchNamespace, guardrails.KillSwitchName, reason)
+	}
+	if namespaceMatches(guardrails.ExcludeNamespaces, namespace) {
+		return fmt.Sprintf("namespace %s is excluded from automatic actions", namespace)
+	}
+	if len(guardrails.Namespaces) > 0 && !namespaceMatches(guardrails.Namespaces, namespace) {
+		return fmt.Sprintf("namespace %s is not in the automatic action allowlist", namespace)
+	}
+	for _, window := range guardrails.FreezeWindows {
+		if end, active := window.Active(now); active {
+			return fmt.Sprintf("freeze window %q is active until %s", window.Spec, end.Format("2006-01-02 15:04:05"))
+		}
+	}
+	return ""
+}
+
+func namespaceMatches(patterns []string, namespace string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// 自动处置被全局开关阻止时只通知
+func (w *PodWatcher) blockByGuardrail(pod *v1.Pod, record PodRecord, policy Policy, reason string, logTail *LogTail) {
+	logrus.WithFields(logrus.Fields{
+		"workload":  record.Workload(),
+		"namespace": record.Namespace,
+		"reason":    reason,
+	}).Warn("Automatic action blocked by guardrail")
+
+	message := fmt.Sprintf("Automatic action skipped, notify only: %s", reason)
+	if policy.rollbackDryRun() {
+		message = fmt.Sprintf("Dry run: automatic action would be blocked: %s", reason)
+	}
+	w.sendRollbackMessage(pod, record, message, "", policy, logTail)
+}
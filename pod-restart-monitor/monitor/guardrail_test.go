@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"context"
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGuardrailReason(t *testing.T) {
+	window, err := config.ParseFreezeWindow("0 18 * * 5 64h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher, _ := newTestWatcher(t, &config.Config{Guardrails: config.Guardrails{
+		Namespaces:          []string{"team-*", "payments"},
+		ExcludeNamespaces:   []string{"team-db"},
+		FreezeWindows:       []config.FreezeWindow{window},
+		KillSwitchNamespace: "podsentry",
+		KillSwitchName:      "kill-switch",
+	}})
+	// 2026-10-14 为周三，不在冻结窗口内
+	weekday := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+	weekend := time.Date(2026, time.October, 17, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		namespace string
+		now       time.Time
+		want      string // 为空表示允许
+	}{
+		{name: "allowed by pattern", namespace: "team-web", now: weekday},
+		{name: "allowed by name", namespace: "payments", now: weekday},
+		{name: "excluded wins over allowlist", namespace: "team-db", now: weekday, want: "excluded"},
+		{name: "not in allowlist", namespace: "default", now: weekday, want: "allowlist"},
+		{name: "freeze window", namespace: "payments", now: weekend, want: "freeze window"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := watcher.guardrailReason(tt.namespace, tt.now)
+			if (reason != "") != (tt.want != "") || !strings.Contains(reason, tt.want) {
+				t.Errorf("guardrailReason = %q, want %q", reason, tt.want)
+			}
+		})
+	}
+
+	// kill switch优先于其他规则
+	watcher.killSwitch.set(&v1.ConfigMap{Data: map[string]string{KillSwitchDisabledKey: "true", KillSwitchReasonKey: "incident"}})
+	if reason := watcher.guardrailReason("payments", weekday); !strings.Contains(reason, "kill switch podsentry/kill-switch is on: incident") {
+		t.Errorf("guardrailReason = %q, want kill switch", reason)
+	}
+	watcher.killSwitch.set(nil)
+	if reason := watcher.guardrailReason("payments", weekday); reason != "" {
+		t.Errorf("kill switch not cleared: %q", reason)
+	}
+}
+
+func TestStartKillSwitch(t *testing.T) {
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kill-switch", Namespace: "podsentry"},
+		Data:       map[string]string{KillSwitchDisabledKey: "true", KillSwitchReasonKey: "incident"},
+	}
+	cfg := &config.Config{Guardrails: config.Guardrails{KillSwitchNamespace: "podsentry", KillSwitchName: "kill-switch"}}
+	watcher, client := newTestWatcher(t, cfg, cm)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := StartKillSwitch(ctx, client, watcher, cfg); err != nil {
+		t.Fatal(err)
+	}
+	// 首次同步后立即生效
+	if disabled, reason := watcher.killSwitch.get(); !disabled || reason != "incident" {
+		t.Fatalf("kill switch = %v/%q after sync", disabled, reason)
+	}
+
+	if err := client.CoreV1().ConfigMaps("podsentry").Delete(context.TODO(), "kill-switch", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if disabled, _ := watcher.killSwitch.get(); !disabled {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("kill switch still on after the configmap was deleted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,549 @@
+package monitor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/restmapper"
+	"sigs.k8s.io/yaml"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Helm写在其管理的资源上的注解
+const (
+	AnnotationHelmReleaseName      = "meta.helm.sh/release-name"
+	AnnotationHelmReleaseNamespace = "meta.helm.sh/release-namespace"
+)
+
+// Helm 3 在Secret中保存Release历史，名称为 sh.helm.release.v1.<release>.v<revision>
+const (
+	helmReleaseSecretType   = "helm.sh/release.v1"
+	helmReleaseSecretPrefix = "sh.helm.release.v1."
+	helmStatusDeployed      = "deployed"
+	helmStatusSuperseded    = "superseded"
+	helmStatusFailed        = "failed"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b, 0x08}
+
+// 工作负载由Helm管理，按配置只通知不回滚
+var errHelmManaged = errors.New("workload is managed by helm")
+
+// helmRelease Release的一个版本，只解析回滚需要的字段，其余字段原样保留在raw中
+type helmRelease struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Version   int64  `json:"version"`
+	Info      struct {
+		Status        string `json:"status"`
+		Description   string `json:"description"`
+		FirstDeployed string `json:"first_deployed"`
+	} `json:"info"`
+	Chart struct {
+		Metadata struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"metadata"`
+	} `json:"chart"`
+	Manifest string `json:"manifest"`
+
+	raw    map[string]interface{}
+	secret *v1.Secret
+}
+
+func (r *helmRelease) chart() string {
+	return fmt.Sprintf("%s-%s", r.Chart.Metadata.Name, r.Chart.Metadata.Version)
+}
+
+// 内容实际对应的版本，helm rollback 生成的新版本描述为 "Rollback to N"
+// Release回滚生成新版本号，本轮回滚掉的版本按内容对应的版本记录
+const schemeHelm = "helm"
+
+func (r *helmRelease) contentVersion() int64 {
+	var version int64
+	if _, err := fmt.Sscanf(r.Info.Description, "Rollback to %d", &version); err == nil {
+		return version
+	}
+	return r.Version
+}
+
+// 工作负载所属的Helm Release，非Helm管理时返回空
+func helmReleaseOf(meta *metav1.ObjectMeta) (string, string) {
+	name := meta.Annotations[AnnotationHelmReleaseName]
+	if name == "" {
+		return "", ""
+	}
+	namespace := meta.Annotations[AnnotationHelmReleaseNamespace]
+	if namespace == "" {
+		namespace = meta.Namespace
+	}
+	return name, namespace
+}
+
+// 回滚Pod所属的工作负载: GitOps管理的按 GITOPS_STRATEGY 处理，Helm管理的按 HELM_ROLLBACK 回滚整个Release或拒绝回滚
+func (w *PodWatcher) rollbackWorkload(pod *v1.Pod, record PodRecord, opts RollbackOptions) (*RollbackResult, error) {
+	meta, err := w.workloadMeta(record)
+	if err != nil {
+		return nil, err
+	}
+	var note string
+	if owner := gitOpsOwnerOf(meta, w.config.ArgoCDNamespace); owner != nil {
+		var result *RollbackResult
+		var done bool
+		if result, note, done, err = w.rollbackGitOps(owner, record, meta, opts); done || err != nil {
+			return result, err
+		}
+	}
+
+	result, err := w.rollbackTemplate(pod, record, meta, opts)
+	if err != nil && note != "" {
+		// 已暂停的GitOps控制器需要人工恢复
+		return nil, fmt.Errorf("%w; %s", err, note)
+	}
+	if result != nil && note != "" {
+		result.Note = strings.TrimPrefix(result.Note+"; "+note, "; ")
+	}
+	return result, err
+}
+
+func (w *PodWatcher) rollbackTemplate(pod *v1.Pod, record PodRecord, meta *metav1.ObjectMeta, opts RollbackOptions) (*RollbackResult, error) {
+	name, namespace := helmReleaseOf(meta)
+	switch {
+	case name == "" && record.WorkloadKind == "Rollout":
+		return w.rollbackArgoRollout(record, opts)
+	case name == "":
+		return PodRollback(pod, w.client, opts)
+	}
+
+	releases, err := w.helmReleaseHistory(name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	current, target, err := helmRollbackTarget(releases, opts)
+	if err != nil {
+		return nil, fmt.Errorf("helm release %s/%s: %w", namespace, name, err)
+	}
+	if err := opts.checkTarget(schemeHelm, strconv.FormatInt(target.contentVersion(), 10), target.contentVersion()); err != nil {
+		return nil, err
+	}
+	if w.config.HelmRollback != config.HelmRollbackRelease {
+		// 直接修改工作负载会使Release与集群不一致，下次helm upgrade会重新发布故障版本
+		return nil, fmt.Errorf("%w: %s belongs to release %s/%s revision %d (chart %s), run: helm rollback %s %d -n %s",
+			errHelmManaged, record.Workload(), namespace, name, current.Version, current.chart(), name, target.Version, namespace)
+	}
+	return w.rollbackHelmRelease(record, current, target, opts.DryRun)
+}
+
+// 读取Release的全部历史版本，按版本升序
+func (w *PodWatcher) helmReleaseHistory(name, namespace string) ([]*helmRelease, error) {
+	secrets, err := w.client.CoreV1().Secrets(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("owner=helm,name=%s", name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list helm release secrets: %w", err)
+	}
+
+	var releases []*helmRelease
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if secret.Type != helmReleaseSecretType {
+			continue
+		}
+		release, err := decodeHelmRelease(secret.Data["release"])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode helm release secret %s: %w", secret.Name, err)
+		}
+		release.secret = secret
+		releases = append(releases, release)
+	}
+	sort.Slice(releases, func(i, j int) bool {
+		return releases[i].Version < releases[j].Version
+	})
+	return releases, nil
+}
+
+// 与 helm rollback 一致回滚到上一个版本；当前版本本身是回滚生成的时，跳过它的内容对应的版本，同时跳过本轮已回滚掉的版本
+func helmRollbackTarget(releases []*helmRelease, opts RollbackOptions) (*helmRelease, *helmRelease, error) {
+	if len(releases) == 0 {
+		return nil, nil, errors.New("no release history")
+	}
+	current := releases[len(releases)-1]
+	if current.Info.Status != helmStatusDeployed {
+		return nil, nil, fmt.Errorf("latest revision %d is %s, not deployed", current.Version, current.Info.Status)
+	}
+
+	base := current.contentVersion()
+	for i := len(releases) - 2; i >= 0; i-- {
+		release := releases[i]
+		if opts.skips(schemeHelm, strconv.FormatInt(release.contentVersion(), 10)) {
+			continue
+		}
+		if release.Version < base && release.Info.Status == helmStatusSuperseded {
+			return current, release, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no previous revision to roll back to from revision %d", current.Version)
+}
+
+// Helm方式的回滚: 以三方合并提交目标版本清单中的资源，然后生成新的Release版本
+// 目标版本中已不存在的资源保留不删除，在结果中列出供人工处理
+func (w *PodWatcher) rollbackHelmRelease(record PodRecord, current, target *helmRelease, dryRun bool) (*RollbackResult, error) {
+	if w.dynamic == nil {
+		return nil, errors.New("dynamic client is not configured for helm rollback")
+	}
+	logrus.WithFields(logrus.Fields{
+		"release":  current.Name,
+		"from":     current.Version,
+		"to":       target.Version,
+		"workload": record.Workload(),
+		"dryRun":   dryRun,
+	}).Info("Rolling back helm release")
+
+	currentObjects, err := manifestObjects(current.Manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest of revision %d: %w", current.Version, err)
+	}
+	targetObjects, err := manifestObjects(target.Manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest of revision %d: %w", target.Version, err)
+	}
+
+	result := &RollbackResult{
+		Kind:         record.WorkloadKind,
+		Name:         record.WorkloadName,
+		Namespace:    record.Namespace,
+		FromRevision: current.Version,
+		Scheme:       schemeHelm,
+		FromVersion:  strconv.FormatInt(current.contentVersion(), 10),
+		ToRevision:   target.Version,
+		DryRun:       dryRun,
+		Owner:        "helm release " + current.Name,
+		Diff:         lineDiff(strings.Split(current.Manifest, "\n"), strings.Split(target.Manifest, "\n")),
+	}
+
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(w.client.Discovery()))
+	originals := make(map[string]*unstructured.Unstructured)
+	for _, obj := range currentObjects {
+		originals[objectKey(obj, current.Namespace)] = obj
+	}
+	// 与helm一致按资源类型的安装顺序提交，单个资源失败时继续提交其余资源
+	sortByInstallOrder(targetObjects)
+	var applied, failed []string
+	var applyErrs []error
+	for _, obj := range targetObjects {
+		key := objectKey(obj, target.Namespace)
+		generation, err := w.applyHelmObject(mapper, originals[key], obj, target.Namespace, dryRun)
+		delete(originals, key)
+		if err != nil {
+			failed = append(failed, key)
+			applyErrs = append(applyErrs, fmt.Errorf("failed to apply %s: %w", key, err))
+			continue
+		}
+		applied = append(applied, key)
+		if obj.GetKind() == record.WorkloadKind && obj.GetName() == record.WorkloadName {
+			result.Generation = generation
+		}
+	}
+	applyErr := errors.Join(applyErrs...)
+	result.Note = fmt.Sprintf("applied %d/%d resources of revision %d: %s", len(applied), len(targetObjects), target.Version, strings.Join(applied, ", "))
+	if len(failed) > 0 {
+		result.Note = fmt.Sprintf("%s; failed: %s", result.Note, strings.Join(failed, ", "))
+	}
+	if applyErr == nil && len(originals) > 0 {
+		var kept []string
+		for key := range originals {
+			kept = append(kept, key)
+		}
+		sort.Strings(kept)
+		result.Diff = fmt.Sprintf("resources not in revision %d were kept: %s\n%s", target.Version, strings.Join(kept, ", "), result.Diff)
+	}
+
+	if dryRun {
+		return result, applyErr
+	}
+	// 与helm一致，回滚失败同样记录为失败的新版本
+	if err := w.recordHelmRollback(current, target, applyErr); err != nil {
+		logrus.WithError(err).WithField("release", current.Name).Error("Failed to record helm rollback in release history")
+		if applyErr == nil {
+			applyErr = err
+		}
+	}
+	return result, applyErr
+}
+
+// 提交清单中的一个资源，返回提交后的generation
+func (w *PodWatcher) applyHelmObject(mapper meta.RESTMapper, original, target *unstructured.Unstructured, namespace string, dryRun bool) (int64, error) {
+	gvk := target.GroupVersionKind()
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return 0, err
+	}
+	resource := w.dynamic.Resource(mapping.Resource)
+	client := resource.Namespace("")
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if target.GetNamespace() == "" {
+			target.SetNamespace(namespace)
+		}
+		client = resource.Namespace(target.GetNamespace())
+	}
+
+	live, err := client.Get(context.TODO(), target.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		created, err := client.Create(context.TODO(), target, metav1.CreateOptions{DryRun: dryRunOption(dryRun)})
+		if err != nil {
+			return 0, err
+		}
+		return created.GetGeneration(), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	patch, patchType, err := helmPatch(original, target, live)
+	if err != nil {
+		return 0, err
+	}
+	patched, err := client.Patch(context.TODO(), target.GetName(), patchType, patch, metav1.PatchOptions{DryRun: dryRunOption(dryRun)})
+	if err != nil {
+		return 0, err
+	}
+	return patched.GetGeneration(), nil
+}
+
+// 与helm相同的三方合并: 内置类型使用strategic merge patch，CRD使用JSON merge patch
+func helmPatch(original, target, live *unstructured.Unstructured) ([]byte, types.PatchType, error) {
+	originalJSON := []byte("{}")
+	if original != nil {
+		var err error
+		if originalJSON, err = original.MarshalJSON(); err != nil {
+			return nil, "", err
+		}
+	}
+	targetJSON, err := target.MarshalJSON()
+	if err != nil {
+		return nil, "", err
+	}
+	liveJSON, err := live.MarshalJSON()
+	if err != nil {
+		return nil, "", err
+	}
+
+	typed, err := scheme.Scheme.New(target.GroupVersionKind())
+	if _, unstructured := typed.(runtime.Unstructured); runtime.IsNotRegisteredError(err) || unstructured {
+		patch, err := jsonmergepatch.CreateThreeWayJSONMergePatch(originalJSON, targetJSON, liveJSON)
+		return patch, types.MergePatchType, err
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	lookup, err := strategicpatch.NewPatchMetaFromStruct(typed)
+	if err != nil {
+		return nil, "", err
+	}
+	patch, err := strategicpatch.CreateThreeWayMergePatch(originalJSON, targetJSON, liveJSON, lookup, true)
+	return patch, types.StrategicMergePatchType, err
+}
+
+// 生成回滚后的新Release版本，并将当前版本标记为superseded，helm history 中可以看到这次回滚
+func (w *PodWatcher) recordHelmRollback(current, target *helmRelease, applyErr error) error {
+	now := time.Now()
+	version := current.Version + 1
+	status, description := helmStatusDeployed, fmt.Sprintf("Rollback to %d", target.Version)
+	if applyErr != nil {
+		status, description = helmStatusFailed, fmt.Sprintf("Rollback %q failed: %v", current.Name, applyErr)
+	}
+
+	// 新版本复制目标版本的内容
+	raw, err := copyRaw(target.raw)
+	if err != nil {
+		return err
+	}
+	raw["version"] = version
+	info, _ := raw["info"].(map[string]interface{})
+	if info == nil {
+		info = make(map[string]interface{})
+		raw["info"] = info
+	}
+	info["status"] = status
+	info["description"] = description
+	info["first_deployed"] = current.Info.FirstDeployed
+	info["last_deployed"] = now.Format(time.RFC3339Nano)
+	data, err := encodeHelmRelease(raw)
+	if err != nil {
+		return err
+	}
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s%s.v%d", helmReleaseSecretPrefix, current.Name, version),
+			Namespace: current.secret.Namespace,
+			Labels:    helmSecretLabels(current.Name, status, version, now),
+		},
+		Type: helmReleaseSecretType,
+		Data: map[string][]byte{"release": data},
+	}
+	if _, err := w.client.CoreV1().Secrets(secret.Namespace).Create(context.TODO(), secret, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create release revision %d: %w", version, err)
+	}
+	if applyErr != nil {
+		return nil
+	}
+
+	if info, _ := current.raw["info"].(map[string]interface{}); info != nil {
+		info["status"] = helmStatusSuperseded
+	}
+	data, err = encodeHelmRelease(current.raw)
+	if err != nil {
+		return err
+	}
+	superseded := current.secret.DeepCopy()
+	superseded.Data["release"] = data
+	superseded.Labels = helmSecretLabels(current.Name, helmStatusSuperseded, current.Version, now)
+	if _, err := w.client.CoreV1().Secrets(superseded.Namespace).Update(context.TODO(), superseded, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to supersede release revision %d: %w", current.Version, err)
+	}
+	return nil
+}
+
+func helmSecretLabels(name, status string, version int64, now time.Time) map[string]string {
+	return map[string]string{
+		"name":       name,
+		"owner":      "helm",
+		"status":     status,
+		"version":    strconv.FormatInt(version, 10),
+		"modifiedAt": strconv.FormatInt(now.Unix(), 10),
+	}
+}
+
+// Release以 gzip + base64 编码保存在Secret中
+func decodeHelmRelease(data []byte) (*helmRelease, error) {
+	decoded, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(decoded, gzipMagic) {
+		reader, err := gzip.NewReader(bytes.NewReader(decoded))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		if decoded, err = io.ReadAll(reader); err != nil {
+			return nil, err
+		}
+	}
+
+	release := &helmRelease{}
+	if err := json.Unmarshal(decoded, release); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(decoded, &release.raw); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+func encodeHelmRelease(raw map[string]interface{}) ([]byte, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+func copyRaw(raw map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	copied := make(map[string]interface{})
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// 解析Release清单中的资源，清单由 "---" 分隔的多个YAML文档组成
+func manifestObjects(manifest string) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	for _, doc := range strings.Split(manifest, "\n---") {
+		object := make(map[string]interface{})
+		if err := yaml.Unmarshal([]byte(doc), &object); err != nil {
+			return nil, err
+		}
+		if len(object) == 0 {
+			continue
+		}
+		objects = append(objects, &unstructured.Unstructured{Object: object})
+	}
+	return objects, nil
+}
+
+// 资源标识，用于在两个版本的清单之间对应同一资源
+func objectKey(obj *unstructured.Unstructured, namespace string) string {
+	if obj.GetNamespace() != "" {
+		namespace = obj.GetNamespace()
+	}
+	return fmt.Sprintf("%s/%s/%s", obj.GroupVersionKind().GroupKind(), namespace, obj.GetName())
+}
+
+// 与helm的InstallOrder一致的资源安装顺序
+var helmInstallOrder = []string{
+	"PriorityClass", "Namespace", "NetworkPolicy", "ResourceQuota", "LimitRange", "PodSecurityPolicy",
+	"PodDisruptionBudget", "ServiceAccount", "Secret", "SecretList", "ConfigMap", "StorageClass",
+	"PersistentVolume", "PersistentVolumeClaim", "CustomResourceDefinition", "ClusterRole", "ClusterRoleList",
+	"ClusterRoleBinding", "ClusterRoleBindingList", "Role", "RoleList", "RoleBinding", "RoleBindingList",
+	"Service", "DaemonSet", "Pod", "ReplicationController", "ReplicaSet", "Deployment", "HorizontalPodAutoscaler",
+	"StatefulSet", "Job", "CronJob", "IngressClass", "Ingress", "APIService",
+	"MutatingWebhookConfiguration", "ValidatingWebhookConfiguration",
+}
+
+// 按安装顺序排序，未知类型排在最后并按类型名排序，同类型保持清单中的顺序
+func sortByInstallOrder(objects []*unstructured.Unstructured) {
+	order := make(map[string]int, len(helmInstallOrder))
+	for i, kind := range helmInstallOrder {
+		order[kind] = i
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		first, firstKnown := order[objects[i].GetKind()]
+		second, secondKnown := order[objects[j].GetKind()]
+		switch {
+		case firstKnown && secondKnown:
+			return first < second
+		case firstKnown != secondKnown:
+			return firstKnown
+		}
+		return objects[i].GetKind() < objects[j].GetKind()
+	})
+}
@@ -0,0 +1,156 @@
+package monitor
+
+import (
+	"encoding/base64"
+	"fmt"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"strings"
+	"testing"
+)
+
+func testRelease(version int64, status, description string) *helmRelease {
+	release := &helmRelease{Name: "payments", Version: version}
+	release.Info.Status = status
+	release.Info.Description = description
+	return release
+}
+
+func TestHelmRollbackTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		releases []*helmRelease
+		opts     RollbackOptions
+		want     int64 // 0表示期望出错
+	}{
+		{
+			name: "previous superseded revision",
+			releases: []*helmRelease{
+				testRelease(1, helmStatusSuperseded, "Install complete"),
+				testRelease(2, helmStatusSuperseded, "Upgrade complete"),
+				testRelease(3, helmStatusDeployed, "Upgrade complete"),
+			},
+			want: 2,
+		},
+		{
+			name: "skips failed revisions",
+			releases: []*helmRelease{
+				testRelease(1, helmStatusSuperseded, "Install complete"),
+				testRelease(2, helmStatusFailed, "Upgrade failed"),
+				testRelease(3, helmStatusDeployed, "Upgrade complete"),
+			},
+			want: 1,
+		},
+		{
+			// 版本4是回滚到2生成的，再次回滚时应回到2之前的版本
+			name: "current revision is a rollback",
+			releases: []*helmRelease{
+				testRelease(1, helmStatusSuperseded, "Install complete"),
+				testRelease(2, helmStatusSuperseded, "Upgrade complete"),
+				testRelease(3, helmStatusSuperseded, "Upgrade complete"),
+				testRelease(4, helmStatusDeployed, "Rollback to 2"),
+			},
+			want: 1,
+		},
+		{
+			name: "skips rolled back content versions",
+			releases: []*helmRelease{
+				testRelease(1, helmStatusSuperseded, "Install complete"),
+				testRelease(2, helmStatusSuperseded, "Upgrade complete"),
+				testRelease(3, helmStatusDeployed, "Upgrade complete"),
+			},
+			opts: RollbackOptions{Scheme: schemeHelm, RolledBackFrom: []string{"2"}},
+			want: 1,
+		},
+		{
+			name: "latest revision not deployed",
+			releases: []*helmRelease{
+				testRelease(1, helmStatusSuperseded, "Install complete"),
+				testRelease(2, helmStatusFailed, "Upgrade failed"),
+			},
+		},
+		{
+			name:     "no previous revision",
+			releases: []*helmRelease{testRelease(1, helmStatusDeployed, "Install complete")},
+		},
+		{name: "no history"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, target, err := helmRollbackTarget(tt.releases, tt.opts)
+			if tt.want == 0 {
+				if err == nil {
+					t.Fatalf("expected error, got target %d", target.Version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if current != tt.releases[len(tt.releases)-1] || target.Version != tt.want {
+				t.Errorf("target = %d, want %d", target.Version, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeHelmRelease(t *testing.T) {
+	raw := map[string]interface{}{
+		"name":      "payments",
+		"namespace": "default",
+		"version":   3,
+		"info":      map[string]interface{}{"status": "deployed", "description": "Rollback to 1"},
+		"chart":     map[string]interface{}{"metadata": map[string]interface{}{"name": "payments", "version": "1.2.0"}},
+		"manifest":  "apiVersion: v1\nkind: ConfigMap\n",
+		"config":    map[string]interface{}{"replicas": 2},
+	}
+	encoded, err := encodeHelmRelease(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := decodeHelmRelease(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Name != "payments" || release.Version != 3 || release.Info.Status != helmStatusDeployed || release.chart() != "payments-1.2.0" {
+		t.Errorf("unexpected release %+v", release)
+	}
+	if release.contentVersion() != 1 {
+		t.Errorf("contentVersion = %d, want 1", release.contentVersion())
+	}
+	// 未解析的字段保留在raw中，写回新版本时不丢失
+	if _, exists := release.raw["config"]; !exists {
+		t.Error("unparsed fields not kept in raw")
+	}
+
+	// 未压缩的Release同样可以解析
+	plain := base64.StdEncoding.EncodeToString([]byte(`{"name":"payments","version":1,"info":{"status":"superseded"}}`))
+	if release, err := decodeHelmRelease([]byte(plain)); err != nil || release.Version != 1 {
+		t.Errorf("decode uncompressed release: %+v, %v", release, err)
+	}
+
+	if _, err := decodeHelmRelease([]byte("not base64!")); err == nil {
+		t.Error("expected error for invalid data")
+	}
+}
+
+func TestSortByInstallOrder(t *testing.T) {
+	var objects []*unstructured.Unstructured
+	for _, kind := range []string{"Deployment", "Widget", "Service", "ConfigMap", "Gadget", "Deployment"} {
+		obj := &unstructured.Unstructured{}
+		obj.SetKind(kind)
+		obj.SetName(fmt.Sprintf("%s-%d", strings.ToLower(kind), len(objects)))
+		objects = append(objects, obj)
+	}
+	sortByInstallOrder(objects)
+
+	var got []string
+	for _, obj := range objects {
+		got = append(got, obj.GetName())
+	}
+	// 同类型保持清单顺序，未知类型排在最后
+	want := "configmap-3,service-2,deployment-0,deployment-5,gadget-4,widget-1"
+	if strings.Join(got, ",") != want {
+		t.Errorf("order = %s, want %s", strings.Join(got, ","), want)
+	}
+}
@@ -0,0 +1,260 @@
+package monitor
+
+import (
+	"context"
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/notify"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronJob连续失败次数记录在CronJob注解上: 失败的Job超过 failedJobsHistoryLimit（默认1）会被删除，无法从保留的Job统计
+const (
+	AnnotationConsecutiveFailures = "podsentry.io/consecutive-failures"
+	AnnotationLastFailedJob       = "podsentry.io/last-failed-job" // 已计数的最近一个失败Job，避免重复计数
+)
+
+// Job失败历史，CronJob按其保留的Job统计，单独的Job按Pod统计
+type jobHistory struct {
+	Succeeded           int
+	Failed              int
+	ConsecutiveFailures int // 从最近一次运行起连续失败的次数
+	LastSuccessful      *time.Time
+}
+
+// 由Job informer调用，Job进入Failed状态时通知一次，CronJob的Job成功时重置连续失败次数
+func (w *PodWatcher) handleJobUpdate(oldJob, newJob *batchv1.Job) {
+	switch {
+	case !jobFinished(oldJob, batchv1.JobComplete) && jobFinished(newJob, batchv1.JobComplete):
+		w.resetCronJobFailures(newJob)
+	case !jobFinished(oldJob, batchv1.JobFailed) && jobFinished(newJob, batchv1.JobFailed):
+		w.handleJobFailed(newJob)
+	}
+}
+
+func jobFinished(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	return jobCondition(job, conditionType) != nil
+}
+
+func jobCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		if job.Status.Conditions[i].Type == conditionType && job.Status.Conditions[i].Status == v1.ConditionTrue {
+			return &job.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// 通知Job失败与运行历史，CronJob连续失败达到 CRONJOB_SUSPEND_AFTER 时暂停
+func (w *PodWatcher) handleJobFailed(job *batchv1.Job) {
+	workload := newWorkload("Job", job.ObjectMeta, replicasOf(job.Spec.Parallelism))
+	var cronJob *batchv1.CronJob
+	if ref := metav1.GetControllerOf(job); ref != nil && ref.Kind == "CronJob" {
+		var err error
+		cronJob, err = w.client.BatchV1().CronJobs(job.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+		if err != nil {
+			logrus.WithField("cronjob", ref.Name).WithError(err).Warn("Failed to get cronjob")
+			return
+		}
+		workload = newWorkload("CronJob", cronJob.ObjectMeta, replicasOf(job.Spec.Parallelism))
+	}
+
+	policy := w.resolveWorkloadPolicy(job.Namespace, workload)
+	if policy.Ignore {
+		return
+	}
+
+	detail := notify.JobDetail{
+		Workload:  workload.String(),
+		Job:       job.Name,
+		Namespace: job.Namespace,
+		Reason:    "Failed",
+	}
+	if condition := jobCondition(job, batchv1.JobFailed); condition != nil {
+		detail.Reason = condition.Reason
+		detail.Message = condition.Message
+	}
+
+	var history jobHistory
+	if cronJob == nil {
+		history = jobHistory{Succeeded: int(job.Status.Succeeded), Failed: int(job.Status.Failed)}
+		if job.Spec.BackoffLimit != nil {
+			detail.History = fmt.Sprintf("pods succeeded %d, failed %d, backoff limit %d",
+				history.Succeeded, history.Failed, *job.Spec.BackoffLimit)
+		} else {
+			detail.History = fmt.Sprintf("pods succeeded %d, failed %d", history.Succeeded, history.Failed)
+		}
+	} else {
+		var err error
+		history, err = w.cronJobHistory(cronJob)
+		if err != nil {
+			logrus.WithField("cronjob", cronJob.Name).WithError(err).Warn("Failed to get cronjob history")
+		}
+		if failures := w.countCronJobFailure(cronJob, job); failures > history.ConsecutiveFailures {
+			history.ConsecutiveFailures = failures
+		}
+		detail.History = fmt.Sprintf("%d consecutive failures, retained runs succeeded %d, failed %d",
+			history.ConsecutiveFailures, history.Succeeded, history.Failed)
+		detail.LastSuccessful = history.LastSuccessful
+		if note := w.suspendCronJob(cronJob, history, policy); note != "" {
+			detail.Message = strings.TrimPrefix(detail.Message+"; "+note, "; ")
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"workload": workload.String(),
+		"job":      job.Name,
+		"reason":   detail.Reason,
+		"history":  detail.History,
+	}).Warn("Job failed")
+	w.sendNotification(policy.NotifyChannel, notify.GetJobMessage(detail))
+}
+
+// 统计CronJob拥有的Job，连续失败次数按创建时间从新到旧计算，跳过仍在运行的Job
+func (w *PodWatcher) cronJobHistory(cronJob *batchv1.CronJob) (jobHistory, error) {
+	history := jobHistory{}
+	if cronJob.Status.LastSuccessfulTime != nil {
+		lastSuccessful := cronJob.Status.LastSuccessfulTime.Time
+		history.LastSuccessful = &lastSuccessful
+	}
+
+	// 每个失败的Job都会统计一次，优先读取informer缓存
+	all, err := w.listJobs(cronJob.Namespace)
+	if err != nil {
+		return history, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	var jobs []*batchv1.Job
+	for _, job := range all {
+		if ref := metav1.GetControllerOf(job); ref != nil && ref.Kind == "CronJob" && ref.UID == cronJob.UID {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[j].CreationTimestamp.Before(&jobs[i].CreationTimestamp)
+	})
+
+	streak := true
+	for _, job := range jobs {
+		switch {
+		case jobFinished(job, batchv1.JobComplete):
+			history.Succeeded++
+			streak = false
+			if history.LastSuccessful == nil && job.Status.CompletionTime != nil {
+				lastSuccessful := job.Status.CompletionTime.Time
+				history.LastSuccessful = &lastSuccessful
+			}
+		case jobFinished(job, batchv1.JobFailed):
+			history.Failed++
+			if streak {
+				history.ConsecutiveFailures++
+			}
+		}
+	}
+	return history, nil
+}
+
+// 累加CronJob注解中的连续失败次数，返回累加后的次数
+func (w *PodWatcher) countCronJobFailure(cronJob *batchv1.CronJob, job *batchv1.Job) int {
+	failures, _ := strconv.Atoi(cronJob.Annotations[AnnotationConsecutiveFailures])
+	if cronJob.Annotations[AnnotationLastFailedJob] == job.Name {
+		return failures
+	}
+	failures++
+	// 注解写入同样受kill switch控制
+	if disabled, _ := w.killSwitch.get(); disabled {
+		return failures
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				AnnotationConsecutiveFailures: strconv.Itoa(failures),
+				AnnotationLastFailedJob:       job.Name,
+			},
+		},
+	})
+	if err != nil {
+		return failures
+	}
+	_, err = w.client.BatchV1().CronJobs(cronJob.Namespace).Patch(context.TODO(), cronJob.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		logrus.WithField("cronjob", cronJob.Name).WithError(err).Warn("Failed to record consecutive failures")
+	}
+	return failures
+}
+
+// CronJob的Job成功后清除连续失败次数
+func (w *PodWatcher) resetCronJobFailures(job *batchv1.Job) {
+	ref := metav1.GetControllerOf(job)
+	if ref == nil || ref.Kind != "CronJob" {
+		return
+	}
+	cronJob, err := w.client.BatchV1().CronJobs(job.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+	if err != nil {
+		logrus.WithField("cronjob", ref.Name).WithError(err).Warn("Failed to get cronjob")
+		return
+	}
+	if _, exists := cronJob.Annotations[AnnotationConsecutiveFailures]; !exists {
+		return
+	}
+	if disabled, _ := w.killSwitch.get(); disabled {
+		return
+	}
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:null,%q:null}}}`, AnnotationConsecutiveFailures, AnnotationLastFailedJob))
+	_, err = w.client.BatchV1().CronJobs(cronJob.Namespace).Patch(context.TODO(), cronJob.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		logrus.WithField("cronjob", cronJob.Name).WithError(err).Warn("Failed to reset consecutive failures")
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"cronjob": cronJob.Name,
+		"job":     job.Name,
+	}).Info("CronJob succeeded, consecutive failures reset")
+}
+
+// 连续失败达到阈值时暂停CronJob，返回写入通知的说明；回滚模式关闭或需要审批时只给出暂停命令
+func (w *PodWatcher) suspendCronJob(cronJob *batchv1.CronJob, history jobHistory, policy Policy) string {
+	if policy.CronJobSuspend <= 0 || history.ConsecutiveFailures < policy.CronJobSuspend {
+		return ""
+	}
+	if cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend {
+		return "cronjob is already suspended"
+	}
+	resume := fmt.Sprintf(`kubectl patch cronjob %s -n %s -p '{"spec":{"suspend":false}}'`, cronJob.Name, cronJob.Namespace)
+	if !policy.rollbackEnabled() || policy.rollbackApproval() {
+		return fmt.Sprintf(`%d consecutive failed runs, suspend it with: kubectl patch cronjob %s -n %s -p '{"spec":{"suspend":true}}'`,
+			history.ConsecutiveFailures, cronJob.Name, cronJob.Namespace)
+	}
+
+	if reason := w.guardrailReason(cronJob.Namespace, time.Now()); reason != "" {
+		return fmt.Sprintf(`%d consecutive failed runs, suspension blocked: %s`, history.ConsecutiveFailures, reason)
+	}
+
+	dryRun := policy.rollbackDryRun()
+	// 同时清除连续失败次数，人工恢复后重新计数
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:null,%q:null}},"spec":{"suspend":true}}`,
+		AnnotationConsecutiveFailures, AnnotationLastFailedJob))
+	_, err := w.client.BatchV1().CronJobs(cronJob.Namespace).Patch(context.TODO(), cronJob.Name,
+		types.MergePatchType, patch, metav1.PatchOptions{DryRun: dryRunOption(dryRun)})
+	if err != nil {
+		logrus.WithField("cronjob", cronJob.Name).WithError(err).Error("Failed to suspend cronjob")
+		return fmt.Sprintf("failed to suspend cronjob after %d consecutive failed runs: %v", history.ConsecutiveFailures, err)
+	}
+	logrus.WithFields(logrus.Fields{
+		"cronjob":  cronJob.Name,
+		"failures": history.ConsecutiveFailures,
+		"dryRun":   dryRun,
+	}).Warn("CronJob suspended")
+	if dryRun {
+		return fmt.Sprintf("Dry run: cronjob would be suspended after %d consecutive failed runs", history.ConsecutiveFailures)
+	}
+	return fmt.Sprintf("cronjob suspended after %d consecutive failed runs, fix it then resume with: %s",
+		history.ConsecutiveFailures, resume)
+}
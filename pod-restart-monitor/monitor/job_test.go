@@ -0,0 +1,133 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	clienttesting "k8s.io/client-go/testing"
+	"testing"
+	"time"
+)
+
+var cronJobStart = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+func testCronJob(annotations map[string]string) *batchv1.CronJob {
+	return &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{
+		Name:        "report",
+		Namespace:   "default",
+		UID:         "uid-report",
+		Annotations: annotations,
+	}}
+}
+
+// 第hour小时创建的Job，condition为空表示仍在运行
+func cronJobRun(hour int, condition batchv1.JobConditionType, owner types.UID) *batchv1.Job {
+	created := cronJobStart.Add(time.Duration(hour) * time.Hour)
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name:              "report-" + created.Format("150405"),
+		Namespace:         "default",
+		CreationTimestamp: metav1.NewTime(created),
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "batch/v1", Kind: "CronJob", Name: "report", UID: owner, Controller: boolPtr(true)},
+		},
+	}}
+	if condition != "" {
+		completed := metav1.NewTime(created.Add(time.Minute))
+		job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: v1.ConditionTrue}}
+		if condition == batchv1.JobComplete {
+			job.Status.CompletionTime = &completed
+		}
+	}
+	return job
+}
+
+func TestCronJobHistory(t *testing.T) {
+	objects := []runtime.Object{
+		cronJobRun(1, batchv1.JobFailed, "uid-report"),
+		cronJobRun(2, batchv1.JobComplete, "uid-report"),
+		cronJobRun(3, batchv1.JobFailed, "uid-report"),
+		cronJobRun(4, batchv1.JobFailed, "uid-report"),
+		cronJobRun(5, "", "uid-report"),               // 仍在运行，不计入
+		cronJobRun(6, batchv1.JobFailed, "uid-other"), // 同名的其他CronJob
+	}
+	watcher, _ := newTestWatcher(t, nil, objects...)
+
+	history, err := watcher.cronJobHistory(testCronJob(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Succeeded != 1 || history.Failed != 3 || history.ConsecutiveFailures != 2 {
+		t.Errorf("history = %+v, want succeeded 1, failed 3, consecutive 2", history)
+	}
+	if want := cronJobStart.Add(2*time.Hour + time.Minute); history.LastSuccessful == nil || !history.LastSuccessful.Equal(want) {
+		t.Errorf("LastSuccessful = %v, want %s", history.LastSuccessful, want)
+	}
+
+	// 状态中的最近成功时间优先
+	cronJob := testCronJob(nil)
+	lastSuccessful := metav1.NewTime(cronJobStart.Add(-time.Hour))
+	cronJob.Status.LastSuccessfulTime = &lastSuccessful
+	if history, _ := watcher.cronJobHistory(cronJob); !history.LastSuccessful.Equal(lastSuccessful.Time) {
+		t.Errorf("LastSuccessful = %v, want %s", history.LastSuccessful, lastSuccessful)
+	}
+}
+
+func TestCountCronJobFailure(t *testing.T) {
+	cronJob := testCronJob(nil)
+	watcher, client := newTestWatcher(t, nil, cronJob)
+	get := func() *batchv1.CronJob {
+		cronJob, err := client.BatchV1().CronJobs("default").Get(context.TODO(), "report", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cronJob
+	}
+
+	first, second := cronJobRun(1, batchv1.JobFailed, "uid-report"), cronJobRun(2, batchv1.JobFailed, "uid-report")
+	if failures := watcher.countCronJobFailure(get(), first); failures != 1 {
+		t.Fatalf("failures = %d, want 1", failures)
+	}
+	// 同一个Job的重复事件不重复计数
+	if failures := watcher.countCronJobFailure(get(), first); failures != 1 {
+		t.Fatalf("failures = %d after duplicate event, want 1", failures)
+	}
+	if failures := watcher.countCronJobFailure(get(), second); failures != 2 {
+		t.Fatalf("failures = %d, want 2", failures)
+	}
+	if annotations := get().Annotations; annotations[AnnotationConsecutiveFailures] != "2" || annotations[AnnotationLastFailedJob] != second.Name {
+		t.Errorf("annotations = %v", annotations)
+	}
+
+	watcher.resetCronJobFailures(cronJobRun(3, batchv1.JobComplete, "uid-report"))
+	if annotations := get().Annotations; annotations[AnnotationConsecutiveFailures] != "" || annotations[AnnotationLastFailedJob] != "" {
+		t.Errorf("annotations not cleared after success: %v", annotations)
+	}
+}
+
+func TestCronJobHistoryFromCache(t *testing.T) {
+	watcher, client := newTestWatcher(t, nil, cronJobRun(1, batchv1.JobFailed, "uid-report"), cronJobRun(2, batchv1.JobComplete, "uid-report"))
+	factory := informers.NewSharedInformerFactory(client, 0)
+	watcher.setListers(metav1.NamespaceAll, newWorkloadListers(factory))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer factory.Shutdown()
+	defer cancel()
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	// 缓存同步后不再查询API
+	client.PrependReactor("list", "jobs", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("unexpected job list")
+	})
+	history, err := watcher.cronJobHistory(testCronJob(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Succeeded != 1 || history.Failed != 1 {
+		t.Errorf("history = %+v, want succeeded 1, failed 1", history)
+	}
+}
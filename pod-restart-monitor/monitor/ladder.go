@@ -0,0 +1,93 @@
+package monitor
+
+import (
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"time"
+)
+
+// 升级阶梯进度，独立于重启记录保存: 记录在统计窗口后被清理，阶梯需要跨越多个观察期
+type ladderState struct {
+	Restarts    int // 进入升级阶梯后累计的重启次数
+	Step        int // 已执行的步数
+	StepAt      time.Time
+	LastRestart time.Time
+	Reset       time.Duration // 不再重启多久后从第一步重新开始
+}
+
+// 累计进入升级阶梯后的重启次数，调用方需持有recordsMu
+func (w *PodWatcher) countLadderRestarts(key string, added int, now time.Time, policy Policy) {
+	state := w.ladders[key]
+	state.Restarts += added
+	state.LastRestart = now
+	state.Reset = policy.LadderReset
+	w.ladders[key] = state
+}
+
+// 按升级阶梯处理重启: 累计重启次数达到下一步的要求，且上一步执行后经过观察期仍在重启时，执行下一步
+func (w *PodWatcher) climbLadder(pod *v1.Pod, key string, record PodRecord, policy Policy, now time.Time) {
+	step, state, ok := w.advanceLadder(key, policy, now)
+	if !ok {
+		return
+	}
+
+	reason := fmt.Sprintf("escalation step %d/%d %s@%d, %d restarts since first step",
+		state.Step, len(policy.Ladder), step.Action, step.Restarts, state.Restarts)
+	logrus.WithFields(logrus.Fields{
+		"workload": record.Workload(),
+		"step":     state.Step,
+		"action":   step.Action,
+		"restarts": state.Restarts,
+	}).Info("Escalating remediation")
+
+	stepPolicy := policy
+	switch {
+	case step.Action == config.LadderNotify:
+		stepPolicy.Rollback = config.RollbackModeOff
+	case !policy.rollbackEnabled():
+		reason = fmt.Sprintf("%s, remediation disabled by rollback mode, notify only", reason)
+	default:
+		stepPolicy.Remediation = step.Action
+	}
+	w.handleRestartThreshold(pod, key, now, stepPolicy, reason)
+}
+
+// 检查并推进升级阶梯，返回本次要执行的步骤与推进后的进度
+func (w *PodWatcher) advanceLadder(key string, policy Policy, now time.Time) (config.LadderStep, ladderState, bool) {
+	w.recordsMu.Lock()
+	defer w.recordsMu.Unlock()
+
+	state, exists := w.ladders[key]
+	if !exists || state.Step >= len(policy.Ladder) {
+		return config.LadderStep{}, state, false
+	}
+	step := policy.Ladder[state.Step]
+	if state.Restarts < step.Restarts {
+		return config.LadderStep{}, state, false
+	}
+	// 上一步还在观察期内，先看它能否止住重启
+	if state.Step > 0 && now.Sub(state.StepAt) < policy.LadderGrace {
+		return config.LadderStep{}, state, false
+	}
+
+	state.Step++
+	state.StepAt = now
+	w.ladders[key] = state
+	return step, state, true
+}
+
+// 清理长时间没有重启的升级阶梯，调用方需持有recordsMu
+func (w *PodWatcher) cleanupLadders(now time.Time) {
+	for key, state := range w.ladders {
+		if now.Sub(state.LastRestart) > state.Reset {
+			logrus.WithFields(logrus.Fields{
+				"record":   key,
+				"step":     state.Step,
+				"restarts": state.Restarts,
+			}).Info("No restarts within LADDER_RESET, resetting escalation ladder")
+			delete(w.ladders, key)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package monitor
+
+import (
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"testing"
+	"time"
+)
+
+func TestAdvanceLadder(t *testing.T) {
+	watcher, _ := newTestWatcher(t, nil)
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	policy := Policy{
+		Ladder: []config.LadderStep{
+			{Action: config.LadderNotify, Restarts: 2},
+			{Action: config.RemediationDeletePod, Restarts: 4},
+		},
+		LadderGrace: 10 * time.Minute,
+		LadderReset: time.Hour,
+	}
+	const key = "Deployment/default/web"
+	setRestarts := func(restarts int) {
+		state := watcher.ladders[key]
+		state.Restarts = restarts
+		watcher.ladders[key] = state
+	}
+
+	if _, _, ok := watcher.advanceLadder(key, policy, now); ok {
+		t.Fatal("advanced without restarts")
+	}
+
+	setRestarts(1)
+	if _, _, ok := watcher.advanceLadder(key, policy, now); ok {
+		t.Fatal("advanced below the first step")
+	}
+
+	setRestarts(2)
+	step, state, ok := watcher.advanceLadder(key, policy, now)
+	if !ok || state.Step != 1 || step.Action != config.LadderNotify {
+		t.Fatalf("first step = %v/%d/%v", step, state.Step, ok)
+	}
+	if _, _, ok := watcher.advanceLadder(key, policy, now); ok {
+		t.Fatal("same step executed twice")
+	}
+
+	// 达到下一步的次数，但上一步仍在观察期内
+	setRestarts(4)
+	if _, _, ok := watcher.advanceLadder(key, policy, now.Add(5*time.Minute)); ok {
+		t.Fatal("advanced within the grace period")
+	}
+	step, state, ok = watcher.advanceLadder(key, policy, now.Add(10*time.Minute))
+	if !ok || state.Step != 2 || step.Action != config.RemediationDeletePod {
+		t.Fatalf("second step = %v/%d/%v", step, state.Step, ok)
+	}
+
+	setRestarts(10)
+	if _, _, ok := watcher.advanceLadder(key, policy, now.Add(time.Hour)); ok {
+		t.Fatal("advanced past the last step")
+	}
+}
+
+func TestLadderSurvivesRecordCleanup(t *testing.T) {
+	watcher, _ := newTestWatcher(t, nil)
+	policy := Policy{TimeWindow: 5 * time.Minute, Ladder: []config.LadderStep{{Action: config.LadderNotify, Restarts: 1}}, LadderReset: time.Hour}
+	const key = "Deployment/default/web"
+	now := time.Now()
+
+	watcher.recordsMu.Lock()
+	watcher.records[key] = PodRecord{LastRestart: now.Add(-10 * time.Minute), TimeWindow: policy.TimeWindow}
+	watcher.countLadderRestarts(key, 3, now.Add(-10*time.Minute), policy)
+	watcher.recordsMu.Unlock()
+
+	// 记录超过统计窗口被清理，阶梯进度仍保留
+	watcher.cleanupRecords()
+	if _, exists := watcher.records[key]; exists {
+		t.Fatal("record not cleaned up")
+	}
+	if state := watcher.ladders[key]; state.Restarts != 3 {
+		t.Fatalf("ladder restarts = %d after record cleanup, want 3", state.Restarts)
+	}
+
+	// 超过LADDER_RESET没有重启后从第一步重新开始
+	watcher.recordsMu.Lock()
+	watcher.countLadderRestarts(key, 0, now.Add(-2*time.Hour), policy)
+	watcher.recordsMu.Unlock()
+	watcher.cleanupRecords()
+	if _, exists := watcher.ladders[key]; exists {
+		t.Error("ladder not reset after LADDER_RESET")
+	}
+}
@@ -0,0 +1,222 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"time"
+)
+
+// 最近稳定版本注解，回滚时优先回滚到该版本；版本号在回滚后会被重新编号，同时记录pod-template-hash用于定位ReplicaSet
+const (
+	AnnotationLastKnownGood     = "podsentry.io/last-known-good-revision"
+	AnnotationLastKnownGoodHash = "podsentry.io/last-known-good-hash"
+)
+
+// 正在观察是否稳定的Deployment版本
+type stableCandidate struct {
+	Revision string
+	Since    time.Time
+	Restarts map[string]int32 // 观察开始时各Pod的容器重启次数，nil表示尚未获取
+	timer    *time.Timer
+}
+
+// 所有副本都已更新并就绪、没有旧版本副本
+func deploymentStable(deploy *appsv1.Deployment) bool {
+	replicas := replicasOf(deploy.Spec.Replicas)
+	status := deploy.Status
+	return replicas > 0 && !deploy.Spec.Paused &&
+		status.ObservedGeneration >= deploy.Generation &&
+		status.Replicas == replicas &&
+		status.UpdatedReplicas == replicas &&
+		status.ReadyReplicas == replicas &&
+		status.AvailableReplicas == replicas
+}
+
+// 由Deployment informer调用，版本进入稳定状态后开始计时，持续 STABLE_PERIOD 后记录为最近稳定版本
+func (w *PodWatcher) trackDeployment(deploy *appsv1.Deployment) {
+	if w.config.StablePeriod <= 0 {
+		return
+	}
+	key := fmt.Sprintf("Deployment/%s/%s", deploy.Namespace, deploy.Name)
+	revision := deploy.Annotations[deploymentRevisionAnnotation]
+
+	w.recordsMu.Lock()
+	if revision == "" || !deploymentStable(deploy) || deploy.Annotations[AnnotationLastKnownGood] == revision {
+		w.stopStableCandidate(key)
+		w.recordsMu.Unlock()
+		return
+	}
+	if candidate, exists := w.stable[key]; exists && candidate.Revision == revision {
+		w.recordsMu.Unlock()
+		return
+	}
+	if w.ctx.Err() != nil {
+		w.recordsMu.Unlock()
+		return
+	}
+
+	w.stopStableCandidate(key)
+	since := time.Now()
+	namespace, name := deploy.Namespace, deploy.Name
+	w.stable[key] = stableCandidate{
+		Revision: revision,
+		Since:    since,
+		timer: time.AfterFunc(w.config.StablePeriod, func() {
+			w.confirmStableRevision(key, namespace, name, since)
+		}),
+	}
+	w.recordsMu.Unlock()
+
+	// 记录观察开始时的重启次数，结束时比较
+	restarts, err := w.podRestartCounts(deploy)
+	if err != nil {
+		logrus.WithField("deployment", name).WithError(err).Warn("Failed to get pod restart counts")
+		return
+	}
+	w.recordsMu.Lock()
+	if candidate, exists := w.stable[key]; exists && candidate.Since.Equal(since) {
+		candidate.Restarts = restarts
+		w.stable[key] = candidate
+	}
+	w.recordsMu.Unlock()
+}
+
+// 由Deployment informer调用，Deployment删除后停止观察
+func (w *PodWatcher) untrackDeployment(deploy *appsv1.Deployment) {
+	w.recordsMu.Lock()
+	defer w.recordsMu.Unlock()
+	w.stopStableCandidate(fmt.Sprintf("Deployment/%s/%s", deploy.Namespace, deploy.Name))
+}
+
+// 停止观察并取消计时器，调用方需持有recordsMu
+func (w *PodWatcher) stopStableCandidate(key string) {
+	if candidate, exists := w.stable[key]; exists {
+		candidate.timer.Stop()
+		delete(w.stable, key)
+	}
+}
+
+// 停止所有观察中的版本
+func (w *PodWatcher) stopStableCandidates() {
+	w.recordsMu.Lock()
+	defer w.recordsMu.Unlock()
+	for key := range w.stable {
+		w.stopStableCandidate(key)
+	}
+}
+
+// Deployment各Pod的容器重启次数之和，按Pod UID索引
+func (w *PodWatcher) podRestartCounts(deploy *appsv1.Deployment) (map[string]int32, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deploy.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+	pods, err := w.client.CoreV1().Pods(deploy.Namespace).List(w.ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	restarts := make(map[string]int32, len(pods.Items))
+	for _, pod := range pods.Items {
+		var count int32
+		for _, status := range pod.Status.ContainerStatuses {
+			count += status.RestartCount
+		}
+		restarts[string(pod.UID)] = count
+	}
+	return restarts, nil
+}
+
+// 观察期结束后再次确认版本未变化、仍然就绪且期间没有重启，然后写入注解
+func (w *PodWatcher) confirmStableRevision(key, namespace, name string, since time.Time) {
+	w.recordsMu.Lock()
+	candidate, exists := w.stable[key]
+	if exists && candidate.Since.Equal(since) {
+		delete(w.stable, key)
+	}
+	w.recordsMu.Unlock()
+	// 期间重新开始观察、已取消或正在退出
+	if !exists || !candidate.Since.Equal(since) || candidate.Restarts == nil || w.ctx.Err() != nil {
+		return
+	}
+
+	fields := logrus.Fields{"workload": "Deployment/" + name, "revision": candidate.Revision}
+	deploy, err := w.client.AppsV1().Deployments(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		logrus.WithField("deployment", name).WithError(err).Warn("Failed to get deployment")
+		return
+	}
+	if deploy.Annotations[deploymentRevisionAnnotation] != candidate.Revision || !deploymentStable(deploy) {
+		return
+	}
+	// 按容器重启次数判断，不依赖可能已被清理的重启记录；观察期间新建的Pod从0开始比较
+	restarts, err := w.podRestartCounts(deploy)
+	if err != nil {
+		logrus.WithField("deployment", name).WithError(err).Warn("Failed to get pod restart counts")
+		return
+	}
+	for podUID, count := range restarts {
+		if count > candidate.Restarts[podUID] {
+			logrus.WithFields(fields).Info("Revision restarted during stable period, not recorded as last known good")
+			return
+		}
+	}
+	rsList, err := getAllAssociatedReplicaSets(w.client, deploy)
+	if err != nil {
+		logrus.WithField("deployment", name).WithError(err).Warn("Failed to get replica sets")
+		return
+	}
+	var hash string
+	for _, rs := range rsList {
+		if rs.Annotations[deploymentRevisionAnnotation] == candidate.Revision {
+			hash = rs.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+		}
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				AnnotationLastKnownGood:     candidate.Revision,
+				AnnotationLastKnownGoodHash: hash,
+			},
+		},
+	})
+	if err != nil {
+		return
+	}
+	// 注解写入同样受kill switch控制
+	if disabled, _ := w.killSwitch.get(); disabled {
+		return
+	}
+	if err := patchWorkload(w.client, "Deployment", namespace, name, types.MergePatchType, patch, false); err != nil {
+		logrus.WithField("deployment", name).WithError(err).Warn("Failed to record last known good revision")
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"workload": "Deployment/" + name,
+		"revision": candidate.Revision,
+		"hash":     hash,
+		"stable":   time.Since(since).Round(time.Second),
+	}).Info("Recorded last known good revision")
+}
+
+// 最近稳定版本对应的ReplicaSet，优先按pod-template-hash查找
+func lastKnownGoodReplicaSet(deploy *appsv1.Deployment, rsList []appsv1.ReplicaSet) *appsv1.ReplicaSet {
+	hash := deploy.Annotations[AnnotationLastKnownGoodHash]
+	revision := deploy.Annotations[AnnotationLastKnownGood]
+	for i := range rsList {
+		if hash != "" && rsList[i].Labels[appsv1.DefaultDeploymentUniqueLabelKey] == hash {
+			return &rsList[i]
+		}
+	}
+	for i := range rsList {
+		if hash == "" && revision != "" && rsList[i].Annotations[deploymentRevisionAnnotation] == revision {
+			return &rsList[i]
+		}
+	}
+	return nil
+}
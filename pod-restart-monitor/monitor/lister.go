@@ -0,0 +1,151 @@
+package monitor
+
+import (
+	"context"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// 单个命名空间（或全集群）informer缓存中的工作负载，解析Pod所属工作负载时优先查询
+type workloadListers struct {
+	replicaSets  appslisters.ReplicaSetLister
+	deployments  appslisters.DeploymentLister
+	statefulSets appslisters.StatefulSetLister
+	daemonSets   appslisters.DaemonSetLister
+	jobs         batchlisters.JobLister
+	jobsSynced   cache.InformerSynced // 列出Job时需要完整的缓存，未同步时回退到API查询
+	cronJobs     batchlisters.CronJobLister
+}
+
+// 在factory中注册工作负载informer，需在factory启动前调用
+func newWorkloadListers(factory informers.SharedInformerFactory) *workloadListers {
+	return &workloadListers{
+		replicaSets:  factory.Apps().V1().ReplicaSets().Lister(),
+		deployments:  factory.Apps().V1().Deployments().Lister(),
+		statefulSets: factory.Apps().V1().StatefulSets().Lister(),
+		daemonSets:   factory.Apps().V1().DaemonSets().Lister(),
+		jobs:         factory.Batch().V1().Jobs().Lister(),
+		jobsSynced:   factory.Batch().V1().Jobs().Informer().HasSynced,
+		cronJobs:     factory.Batch().V1().CronJobs().Lister(),
+	}
+}
+
+func (w *PodWatcher) setListers(namespace string, listers *workloadListers) {
+	w.listersMu.Lock()
+	defer w.listersMu.Unlock()
+	w.listers[namespace] = listers
+}
+
+func (w *PodWatcher) removeListers(namespace string) {
+	w.listersMu.Lock()
+	defer w.listersMu.Unlock()
+	delete(w.listers, namespace)
+}
+
+func (w *PodWatcher) setNamespaceLister(lister corelisters.NamespaceLister) {
+	w.listersMu.Lock()
+	defer w.listersMu.Unlock()
+	w.namespaces = lister
+}
+
+// 命名空间所在informer的lister，全集群监听时使用空命名空间的informer
+func (w *PodWatcher) listersFor(namespace string) *workloadListers {
+	w.listersMu.RLock()
+	defer w.listersMu.RUnlock()
+	if listers, exists := w.listers[namespace]; exists {
+		return listers
+	}
+	return w.listers[metav1.NamespaceAll]
+}
+
+// 以下查询优先读取informer缓存，缓存未同步或未命中时回退到API查询；返回的对象不可修改
+
+func (w *PodWatcher) getNamespace(name string) (*v1.Namespace, error) {
+	w.listersMu.RLock()
+	lister := w.namespaces
+	w.listersMu.RUnlock()
+	if lister != nil {
+		if ns, err := lister.Get(name); err == nil {
+			return ns, nil
+		}
+	}
+	return w.client.CoreV1().Namespaces().Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+func (w *PodWatcher) getReplicaSet(namespace, name string) (*appsv1.ReplicaSet, error) {
+	if listers := w.listersFor(namespace); listers != nil {
+		if rs, err := listers.replicaSets.ReplicaSets(namespace).Get(name); err == nil {
+			return rs, nil
+		}
+	}
+	return w.client.AppsV1().ReplicaSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+func (w *PodWatcher) getDeployment(namespace, name string) (*appsv1.Deployment, error) {
+	if listers := w.listersFor(namespace); listers != nil {
+		if deploy, err := listers.deployments.Deployments(namespace).Get(name); err == nil {
+			return deploy, nil
+		}
+	}
+	return w.client.AppsV1().Deployments(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+func (w *PodWatcher) getStatefulSet(namespace, name string) (*appsv1.StatefulSet, error) {
+	if listers := w.listersFor(namespace); listers != nil {
+		if sts, err := listers.statefulSets.StatefulSets(namespace).Get(name); err == nil {
+			return sts, nil
+		}
+	}
+	return w.client.AppsV1().StatefulSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+func (w *PodWatcher) getDaemonSet(namespace, name string) (*appsv1.DaemonSet, error) {
+	if listers := w.listersFor(namespace); listers != nil {
+		if ds, err := listers.daemonSets.DaemonSets(namespace).Get(name); err == nil {
+			return ds, nil
+		}
+	}
+	return w.client.AppsV1().DaemonSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+func (w *PodWatcher) getJob(namespace, name string) (*batchv1.Job, error) {
+	if listers := w.listersFor(namespace); listers != nil {
+		if job, err := listers.jobs.Jobs(namespace).Get(name); err == nil {
+			return job, nil
+		}
+	}
+	return w.client.BatchV1().Jobs(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+func (w *PodWatcher) getCronJob(namespace, name string) (*batchv1.CronJob, error) {
+	if listers := w.listersFor(namespace); listers != nil {
+		if cronJob, err := listers.cronJobs.CronJobs(namespace).Get(name); err == nil {
+			return cronJob, nil
+		}
+	}
+	return w.client.BatchV1().CronJobs(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// 命名空间中的所有Job，缓存同步前查询API
+func (w *PodWatcher) listJobs(namespace string) ([]*batchv1.Job, error) {
+	if listers := w.listersFor(namespace); listers != nil && listers.jobsSynced() {
+		return listers.jobs.Jobs(namespace).List(labels.Everything())
+	}
+	list, err := w.client.BatchV1().Jobs(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*batchv1.Job, len(list.Items))
+	for i := range list.Items {
+		jobs[i] = &list.Items[i]
+	}
+	return jobs, nil
+}
@@ -0,0 +1,77 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 获取日志的超时时间
+const logFetchTimeout = 10 * time.Second
+
+// LogTail 崩溃容器上一次运行的日志尾部
+type LogTail struct {
+	PodName   string
+	Container string
+	Content   string
+}
+
+// 获取记录中最近一次重启的容器的上一次运行日志，已脱敏；未启用或失败时返回nil
+func (w *PodWatcher) fetchLogTail(record PodRecord) *LogTail {
+	if w.config.LogTailLines <= 0 || len(record.Restarts) == 0 {
+		return nil
+	}
+	last := record.Restarts[len(record.Restarts)-1]
+
+	tailLines := int64(w.config.LogTailLines)
+	limitBytes := int64(w.config.LogTailBytes)
+	options := &v1.PodLogOptions{
+		Container: last.Container,
+		Previous:  true,
+		TailLines: &tailLines,
+	}
+	if limitBytes > 0 {
+		options.LimitBytes = &limitBytes
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), logFetchTimeout)
+	defer cancel()
+	raw, err := w.client.CoreV1().Pods(record.Namespace).GetLogs(last.PodName, options).DoRaw(ctx)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"podName":   last.PodName,
+			"namespace": record.Namespace,
+			"container": last.Container,
+		}).WithError(err).Warn("Failed to fetch previous container logs")
+		return nil
+	}
+
+	return &LogTail{
+		PodName:   last.PodName,
+		Container: last.Container,
+		Content:   redactLogs(string(raw), w.config.LogRedactPatterns),
+	}
+}
+
+// 按正则脱敏，正则包含分组时保留第一个分组（如 "password=" 前缀）
+func redactLogs(content string, patterns []*regexp.Regexp) string {
+	for _, pattern := range patterns {
+		replacement := "[REDACTED]"
+		if pattern.NumSubexp() > 0 {
+			replacement = "${1}[REDACTED]"
+		}
+		content = pattern.ReplaceAllString(content, replacement)
+	}
+	return strings.TrimRight(content, "\n")
+}
+
+func (t *LogTail) String() string {
+	if t == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", t.PodName, t.Container)
+}
@@ -0,0 +1,136 @@
+package monitor
+
+import (
+	"context"
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NamespaceWatcher 监听命名空间的创建、标签变更与删除，动态启停对应的Pod informer
+type NamespaceWatcher struct {
+	client   kubernetes.Interface
+	pods     *PodInformerManager
+	config   *config.Config
+	selector labels.Selector
+	allowed  map[string]bool // 静态命名空间列表，为空表示不限制
+	excluded map[string]bool
+	factory  informers.SharedInformerFactory
+}
+
+func NewNamespaceWatcher(client kubernetes.Interface, pods *PodInformerManager, cfg *config.Config) (*NamespaceWatcher, error) {
+	selector, err := labels.Parse(cfg.NamespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespace selector %q: %w", cfg.NamespaceSelector, err)
+	}
+
+	allowed := make(map[string]bool)
+	for _, ns := range cfg.Namespaces {
+		if ns != metav1.NamespaceAll {
+			allowed[ns] = true
+		}
+	}
+	excluded := make(map[string]bool)
+	for _, ns := range cfg.ExcludeNamespaces {
+		excluded[ns] = true
+	}
+
+	return &NamespaceWatcher{
+		client:   client,
+		pods:     pods,
+		config:   cfg,
+		selector: selector,
+		allowed:  allowed,
+		excluded: excluded,
+	}, nil
+}
+
+// Start 启动命名空间informer，等待首次同步后返回
+func (n *NamespaceWatcher) Start(ctx context.Context) error {
+	n.factory = informers.NewSharedInformerFactory(n.client, n.config.ResyncPeriod)
+	nsInformer := n.factory.Core().V1().Namespaces().Informer()
+	n.pods.watcher.setNamespaceLister(n.factory.Core().V1().Namespaces().Lister())
+
+	if _, err := nsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if ns, ok := obj.(*v1.Namespace); ok {
+				n.sync(ctx, ns)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if ns, ok := newObj.(*v1.Namespace); ok {
+				n.sync(ctx, ns)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if ns, ok := obj.(*v1.Namespace); ok {
+				n.pods.StopNamespace(ns.Name)
+			}
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to add namespace event handler: %w", err)
+	}
+
+	n.factory.Start(ctx.Done())
+	for informerType, synced := range n.factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("failed to sync %v cache", informerType)
+		}
+	}
+	logrus.WithFields(logrus.Fields{
+		"selector": n.selector.String(),
+		"exclude":  n.config.ExcludeNamespaces,
+	}).Info("Namespace watcher started")
+	return nil
+}
+
+// Shutdown 停止命名空间informer
+func (n *NamespaceWatcher) Shutdown() {
+	if n.factory != nil {
+		n.factory.Shutdown()
+	}
+}
+
+// 根据命名空间当前状态启动或停止Pod监听
+func (n *NamespaceWatcher) sync(ctx context.Context, ns *v1.Namespace) {
+	if !n.shouldWatch(ns) {
+		n.pods.StopNamespace(ns.Name)
+		return
+	}
+
+	started, err := n.pods.StartNamespace(ctx, ns.Name)
+	if err != nil {
+		logrus.WithField("namespace", ns.Name).WithError(err).Error("Failed to start pod informer")
+		return
+	}
+	if !started {
+		return
+	}
+	go func() {
+		if err := n.pods.WaitForCacheSync(ns.Name); err != nil {
+			logrus.WithField("namespace", ns.Name).WithError(err).Warn("Pod informer did not sync")
+		}
+	}()
+}
+
+func (n *NamespaceWatcher) shouldWatch(ns *v1.Namespace) bool {
+	if ns.Status.Phase == v1.NamespaceTerminating || ns.DeletionTimestamp != nil {
+		return false
+	}
+	if n.excluded[ns.Name] {
+		return false
+	}
+	if len(n.allowed) > 0 && !n.allowed[ns.Name] {
+		return false
+	}
+	return n.selector.Matches(labels.Set(ns.Labels))
+}
@@ -0,0 +1,105 @@
+package monitor
+
+import (
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Workload Pod所属的顶层控制器
+type Workload struct {
+	Kind        string
+	Name        string
+	Namespace   string
+	Annotations map[string]string
+	Labels      map[string]string
+	Replicas    int32 // 期望副本数
+}
+
+// 解析Pod的顶层控制器（Deployment/Rollout/StatefulSet/DaemonSet/CronJob/Job/ReplicaSet），无控制器时返回nil
+func (w *PodWatcher) resolveWorkload(pod *v1.Pod) (*Workload, error) {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return nil, nil
+	}
+
+	switch ref.Kind {
+	case "ReplicaSet":
+		rs, err := w.getReplicaSet(pod.Namespace, ref.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get replica set: %w", err)
+		}
+		rsRef := metav1.GetControllerOf(rs)
+		if rsRef != nil && rsRef.Kind == "Rollout" && w.dynamic != nil {
+			rollout, err := getArgoRollout(w.dynamic, pod.Namespace, rsRef.Name)
+			if err != nil {
+				return nil, err
+			}
+			replicas, found, _ := unstructured.NestedInt64(rollout.Object, "spec", "replicas")
+			if !found {
+				replicas = 1
+			}
+			return newWorkload("Rollout", *unstructuredMeta(rollout), int32(replicas)), nil
+		}
+		if rsRef == nil || rsRef.Kind != "Deployment" {
+			return newWorkload("ReplicaSet", rs.ObjectMeta, replicasOf(rs.Spec.Replicas)), nil
+		}
+		deploy, err := w.getDeployment(pod.Namespace, rsRef.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get deployment: %w", err)
+		}
+		return newWorkload("Deployment", deploy.ObjectMeta, replicasOf(deploy.Spec.Replicas)), nil
+	case "StatefulSet":
+		sts, err := w.getStatefulSet(pod.Namespace, ref.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get statefulset: %w", err)
+		}
+		return newWorkload("StatefulSet", sts.ObjectMeta, replicasOf(sts.Spec.Replicas)), nil
+	case "DaemonSet":
+		ds, err := w.getDaemonSet(pod.Namespace, ref.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get daemonset: %w", err)
+		}
+		return newWorkload("DaemonSet", ds.ObjectMeta, ds.Status.DesiredNumberScheduled), nil
+	case "Job":
+		job, err := w.getJob(pod.Namespace, ref.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get job: %w", err)
+		}
+		if jobRef := metav1.GetControllerOf(job); jobRef != nil && jobRef.Kind == "CronJob" {
+			cronJob, err := w.getCronJob(pod.Namespace, jobRef.Name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get cronjob: %w", err)
+			}
+			return newWorkload("CronJob", cronJob.ObjectMeta, replicasOf(job.Spec.Parallelism)), nil
+		}
+		return newWorkload("Job", job.ObjectMeta, replicasOf(job.Spec.Parallelism)), nil
+	default:
+		return &Workload{Kind: ref.Kind, Name: ref.Name, Namespace: pod.Namespace, Replicas: 1}, nil
+	}
+}
+
+func newWorkload(kind string, meta metav1.ObjectMeta, replicas int32) *Workload {
+	return &Workload{
+		Kind:        kind,
+		Name:        meta.Name,
+		Namespace:   meta.Namespace,
+		Annotations: meta.Annotations,
+		Labels:      meta.Labels,
+		Replicas:    replicas,
+	}
+}
+
+// 副本数字段为空时按Kubernetes默认值1处理
+func replicasOf(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+// 工作负载的展示名称，如 Deployment/payments-api
+func (wl *Workload) String() string {
+	return wl.Kind + "/" + wl.Name
+}
@@ -0,0 +1,279 @@
+package monitor
+
+import (
+	"context"
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"sync"
+	"time"
+)
+
+// 单个命名空间（或全集群）的informer及其停止函数
+type namespaceInformer struct {
+	factory      informers.SharedInformerFactory
+	eventFactory informers.SharedInformerFactory // 只监听Pod相关的Event
+	ctx          context.Context
+	cancel       context.CancelFunc
+}
+
+// PodInformerManager 基于SharedInformerFactory管理各命名空间的Pod监听
+type PodInformerManager struct {
+	client    kubernetes.Interface
+	watcher   *PodWatcher
+	config    *config.Config
+	informers map[string]*namespaceInformer
+	mu        sync.Mutex
+
+	namespaceFactory informers.SharedInformerFactory // 静态命名空间列表时单独监听命名空间
+}
+
+func NewPodInformerManager(client kubernetes.Interface, watcher *PodWatcher, cfg *config.Config) *PodInformerManager {
+	return &PodInformerManager{
+		client:    client,
+		watcher:   watcher,
+		config:    cfg,
+		informers: make(map[string]*namespaceInformer),
+	}
+}
+
+// Start 为配置中的每个命名空间启动informer，并等待缓存同步
+func (m *PodInformerManager) Start(ctx context.Context) error {
+	// 命名空间注解用于解析策略；不等待同步，未同步或无list权限时按需查询
+	m.namespaceFactory = informers.NewSharedInformerFactory(m.client, m.config.ResyncPeriod)
+	m.watcher.setNamespaceLister(m.namespaceFactory.Core().V1().Namespaces().Lister())
+	m.namespaceFactory.Start(ctx.Done())
+
+	for _, ns := range m.config.Namespaces {
+		if _, err := m.StartNamespace(ctx, ns); err != nil {
+			return err
+		}
+		if err := m.WaitForCacheSync(ns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartNamespace 启动指定命名空间的Pod informer，不等待缓存同步；已存在时返回false
+func (m *PodInformerManager) StartNamespace(ctx context.Context, namespace string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.informers[namespace]; exists {
+		return false, nil
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		m.client,
+		m.config.ResyncPeriod,
+		informers.WithNamespace(namespace),
+	)
+	eventFactory := informers.NewSharedInformerFactoryWithOptions(
+		m.client,
+		m.config.ResyncPeriod,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = "involvedObject.kind=Pod"
+		}),
+	)
+	if err := m.addEventHandlers(namespace, factory, eventFactory); err != nil {
+		return false, fmt.Errorf("failed to start pod informer for namespace %s: %w", displayNamespace(namespace), err)
+	}
+
+	// 解析Pod所属工作负载时优先读取缓存
+	m.watcher.setListers(namespace, newWorkloadListers(factory))
+
+	nsCtx, cancel := context.WithCancel(ctx)
+	m.informers[namespace] = &namespaceInformer{
+		factory:      factory,
+		eventFactory: eventFactory,
+		ctx:          nsCtx,
+		cancel:       cancel,
+	}
+	factory.Start(nsCtx.Done())
+	eventFactory.Start(nsCtx.Done())
+	logrus.WithField("namespace", displayNamespace(namespace)).Info("Pod informer started")
+	return true, nil
+}
+
+// 注册Pod、Job、Deployment与Event的处理函数
+func (m *PodInformerManager) addEventHandlers(namespace string, factory, eventFactory informers.SharedInformerFactory) error {
+	podInformer := factory.Core().V1().Pods().Informer()
+
+	// 监听出错时记录日志，reflector会自动重新list（包括410 Gone）
+	if err := podInformer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		fields := logrus.Fields{"namespace": displayNamespace(namespace)}
+		if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+			logrus.WithFields(fields).WithError(err).Info("Pod watch expired, relisting")
+			return
+		}
+		logrus.WithFields(fields).WithError(err).Error("Pod watch failed")
+	}); err != nil {
+		return fmt.Errorf("failed to set pod watch error handler: %w", err)
+	}
+
+	if _, err := podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			pod, ok := newObj.(*v1.Pod)
+			if !ok {
+				return
+			}
+			HandlePodEvent(m.watcher, pod)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*v1.Pod); ok {
+				HandlePodDelete(m.watcher, pod)
+			}
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to add pod event handler: %w", err)
+	}
+
+	// Job失败时通知运行历史，按需暂停CronJob
+	if _, err := factory.Batch().V1().Jobs().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldJob, ok := oldObj.(*batchv1.Job)
+			if !ok {
+				return
+			}
+			if newJob, ok := newObj.(*batchv1.Job); ok {
+				m.watcher.handleJobUpdate(oldJob, newJob)
+			}
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to add job event handler: %w", err)
+	}
+
+	// 跟踪Deployment各版本是否稳定运行，用于确定回滚目标
+	if _, err := factory.Apps().V1().Deployments().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if deploy, ok := obj.(*appsv1.Deployment); ok {
+				m.watcher.trackDeployment(deploy)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if deploy, ok := newObj.(*appsv1.Deployment); ok {
+				m.watcher.trackDeployment(deploy)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if deploy, ok := obj.(*appsv1.Deployment); ok {
+				m.watcher.untrackDeployment(deploy)
+			}
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to add deployment event handler: %w", err)
+	}
+
+	if _, err := eventFactory.Core().V1().Events().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if event, ok := obj.(*v1.Event); ok {
+				m.watcher.events.Add(event)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if event, ok := newObj.(*v1.Event); ok {
+				m.watcher.events.Add(event)
+			}
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to add event handler: %w", err)
+	}
+	return nil
+}
+
+// 工作负载与Event缓存的同步等待时间，超时后记录日志，缓存未同步期间回退到API查询
+const cacheSyncTimeout = time.Minute
+
+// WaitForCacheSync 等待指定命名空间的Pod缓存同步完成
+// 工作负载与Event缓存只用于减少API查询，缺少list/watch权限时会一直无法同步，在后台限时等待，不阻塞启动
+func (m *PodInformerManager) WaitForCacheSync(namespace string) error {
+	m.mu.Lock()
+	nsInformer, exists := m.informers[namespace]
+	m.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("pod informer for namespace %s not started", displayNamespace(namespace))
+	}
+
+	podInformer := nsInformer.factory.Core().V1().Pods().Informer()
+	if !cache.WaitForCacheSync(nsInformer.ctx.Done(), podInformer.HasSynced) {
+		return fmt.Errorf("failed to sync pod cache for namespace %s", displayNamespace(namespace))
+	}
+	go waitForOptionalCaches(namespace, nsInformer)
+	return nil
+}
+
+// 限时等待其余informer同步，记录未同步的informer
+func waitForOptionalCaches(namespace string, nsInformer *namespaceInformer) {
+	ctx, cancel := context.WithTimeout(nsInformer.ctx, cacheSyncTimeout)
+	defer cancel()
+	for _, factory := range []informers.SharedInformerFactory{nsInformer.factory, nsInformer.eventFactory} {
+		for informerType, synced := range factory.WaitForCacheSync(ctx.Done()) {
+			// 命名空间已停止监听时不记录
+			if !synced && nsInformer.ctx.Err() == nil {
+				logrus.WithFields(logrus.Fields{
+					"namespace": displayNamespace(namespace),
+					"informer":  informerType.String(),
+					"timeout":   cacheSyncTimeout,
+				}).Warn("Informer cache not synced, check list/watch permissions; falling back to API reads")
+			}
+		}
+	}
+}
+
+// StopNamespace 停止指定命名空间的Pod informer
+func (m *PodInformerManager) StopNamespace(namespace string) {
+	m.mu.Lock()
+	nsInformer, exists := m.informers[namespace]
+	if exists {
+		delete(m.informers, namespace)
+	}
+	m.mu.Unlock()
+
+	if !exists {
+		return
+	}
+	m.watcher.removeListers(namespace)
+	nsInformer.cancel()
+	nsInformer.factory.Shutdown()
+	nsInformer.eventFactory.Shutdown()
+	logrus.WithField("namespace", displayNamespace(namespace)).Info("Pod informer stopped")
+}
+
+// Shutdown 停止所有informer并等待其协程退出
+func (m *PodInformerManager) Shutdown() {
+	m.mu.Lock()
+	namespaces := make([]string, 0, len(m.informers))
+	for ns := range m.informers {
+		namespaces = append(namespaces, ns)
+	}
+	m.mu.Unlock()
+
+	for _, ns := range namespaces {
+		m.StopNamespace(ns)
+	}
+	if m.namespaceFactory != nil {
+		m.namespaceFactory.Shutdown()
+	}
+}
+
+func displayNamespace(namespace string) string {
+	if namespace == metav1.NamespaceAll {
+		return "<all>"
+	}
+	return namespace
+}
@@ -0,0 +1,38 @@
+package monitor
+
+import (
+	"context"
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clienttesting "k8s.io/client-go/testing"
+	"testing"
+	"time"
+)
+
+func TestWaitForCacheSyncWithoutWorkloadPermissions(t *testing.T) {
+	watcher, client := newTestWatcher(t, nil)
+	// 没有CronJob的list权限时informer一直无法同步
+	client.PrependReactor("list", "cronjobs", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "batch", Resource: "cronjobs"}, "", nil)
+	})
+	manager := NewPodInformerManager(client, watcher, &config.Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer manager.Shutdown()
+
+	if _, err := manager.StartNamespace(ctx, "default"); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- manager.WaitForCacheSync("default") }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("WaitForCacheSync blocked on the cronjob informer")
+	}
+}
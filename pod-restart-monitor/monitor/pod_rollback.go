@@ -2,31 +2,153 @@ package monitor
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
 	"sort"
 	"strconv"
+	"strings"
 )
 
-func PodRollback(pod *v1.Pod, client kubernetes.Interface) error {
-	logrus.Infof("Pod %s restarted times more than threshold, ready to rollback", pod.Name)
+// RollbackResult 回滚的工作负载与版本，演练模式下描述将要执行的回滚
+type RollbackResult struct {
+	Kind         string
+	Name         string
+	Namespace    string
+	FromRevision int64
+	ToRevision   int64
+	DryRun       bool
+	Generation   int64        // 回滚后工作负载的generation，用于确认控制器已处理回滚
+	Diff         string       // 回滚前后的Pod模板差异
+	Owner        string       // 按Helm Release或Argo CD应用回滚时的回滚对象，版本为其历史版本
+	Note         string       // 回滚前对GitOps控制器的操作等补充说明
+	Scheme       string       // 版本标识的类型，见 RollbackOptions.Scheme
+	FromVersion  string       // 被回滚掉的版本标识，如pod-template-hash，回滚后不会变化
+	ToVersion    string       // 回滚目标的版本标识
+	GitOps       *gitOpsOwner // 按Argo CD应用回滚时，需先确认应用已同步到目标版本
+}
+
+func (r *RollbackResult) Workload() string {
+	return fmt.Sprintf("%s/%s", r.Kind, r.Name)
+}
+
+// 通知中描述回滚对象，Helm回滚时版本号为Release版本
+func (r *RollbackResult) Subject() string {
+	if r.Owner != "" {
+		return fmt.Sprintf("%s of %s", r.Owner, r.Workload())
+	}
+	return r.Workload()
+}
+
+// 回滚后记录在工作负载上的注解
+const (
+	AnnotationRolledBackFrom = "podsentry.io/rolled-back-from"
+	AnnotationRolledBackTo   = "podsentry.io/rolled-back-to"
+
+	podSentryAnnotationPrefix    = "podsentry.io/"
+	changeCauseAnnotation        = "kubernetes.io/change-cause"
+	deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+)
+
+// 回滚时不从ReplicaSet恢复的Deployment注解，与 kubectl rollout undo 一致
+var deploymentAnnotationsToSkip = map[string]bool{
+	v1.LastAppliedConfigAnnotation:              true,
+	deploymentRevisionAnnotation:                true,
+	"deployment.kubernetes.io/revision-history": true,
+	"deployment.kubernetes.io/desired-replicas": true,
+	"deployment.kubernetes.io/max-replicas":     true,
+	"deprecated.deployment.rollback.to":         true,
+}
+
+// 版本标识的类型: Deployment按pod-template-hash，StatefulSet与DaemonSet按ControllerRevision名称
+const (
+	schemeDeployment         = "deployment"
+	schemeControllerRevision = "controller-revision"
+)
+
+// RollbackOptions 回滚选项
+type RollbackOptions struct {
+	DryRun         bool     // 只在服务端演练，不做实际修改
+	Scheme         string   // RolledBackFrom中版本标识的类型
+	RolledBackFrom []string // 本轮已回滚掉的版本标识
+	MaxDepth       int      // 一轮最多回退的版本数，0表示不限制
+	MinRevision    int64    // 不回滚到版本号低于该值的版本，0表示不限制
+}
+
+// 回滚目标已在本轮被回滚掉，或本轮回退的版本数达到上限
+var errRollbackDepth = errors.New("rollback target refused")
+
+// 本轮已回滚掉的版本，类型不同的标识不可比较，视为新的一轮
+func (o RollbackOptions) rolledBackFrom(scheme string) []string {
+	if o.Scheme != scheme {
+		return nil
+	}
+	return o.RolledBackFrom
+}
+
+// 跳过本轮已回滚掉的版本
+func (o RollbackOptions) skips(scheme, version string) bool {
+	for _, rolledBack := range o.rolledBackFrom(scheme) {
+		if rolledBack == version {
+			return true
+		}
+	}
+	return false
+}
+
+// 拒绝回滚到本轮已回滚掉的版本与低于MinRevision的版本；本轮回退的版本数达到MaxDepth时拒绝继续回滚
+func (o RollbackOptions) checkTarget(scheme, target string, revision int64) error {
+	if o.skips(scheme, target) {
+		return fmt.Errorf("%w: version %s was already rolled back from in this round", errRollbackDepth, target)
+	}
+	if o.MinRevision > 0 && revision < o.MinRevision {
+		return fmt.Errorf("%w: target revision %d is below the minimum revision %d", errRollbackDepth, revision, o.MinRevision)
+	}
+	if depth := len(o.rolledBackFrom(scheme)); o.MaxDepth > 0 && depth >= o.MaxDepth {
+		return fmt.Errorf("%w: already rolled back %d versions in this round, max depth is %d", errRollbackDepth, depth, o.MaxDepth)
+	}
+	return nil
+}
+
+// PodRollback 回滚Pod所属的工作负载
+func PodRollback(pod *v1.Pod, client kubernetes.Interface, opts RollbackOptions) (*RollbackResult, error) {
+	logrus.WithFields(logrus.Fields{
+		"pod":    pod.Name,
+		"dryRun": opts.DryRun,
+	}).Info("Pod restarted times more than threshold, ready to rollback")
+	if ref := metav1.GetControllerOf(pod); ref != nil {
+		switch ref.Kind {
+		case "StatefulSet":
+			return rollbackStatefulSet(ref.Name, pod, client, opts)
+		case "DaemonSet":
+			return rollbackDaemonSet(ref.Name, pod, client, opts)
+		}
+	}
+
 	deploymentName, err := findDeploymentForPod(pod, client)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if deploymentName == "" {
-		return fmt.Errorf("no deployment controller found for the pod")
+		return nil, fmt.Errorf("no deployment, statefulset or daemonset controller found for the pod")
 	}
 
-	if err := rollbackDeployment(deploymentName, pod, client); err != nil {
-		return err // 错误日志已在rollbackDeployment中记录
-	}
+	return rollbackDeployment(deploymentName, pod, client, opts)
+}
 
+// 演练模式下的DryRun选项
+func dryRunOption(dryRun bool) []string {
+	if dryRun {
+		return []string{metav1.DryRunAll}
+	}
 	return nil
 }
 
@@ -56,7 +178,7 @@ func findDeploymentForPod(pod *v1.Pod, client kubernetes.Interface) (string, err
 	return "", nil
 }
 
-func rollbackDeployment(deploymentName string, pod *v1.Pod, client kubernetes.Interface) error {
+func rollbackDeployment(deploymentName string, pod *v1.Pod, client kubernetes.Interface, opts RollbackOptions) (*RollbackResult, error) {
 	// 获取目标Deployment
 	deploy, err := client.AppsV1().Deployments(pod.Namespace).Get(
 		context.TODO(),
@@ -64,30 +186,58 @@ func rollbackDeployment(deploymentName string, pod *v1.Pod, client kubernetes.In
 		metav1.GetOptions{},
 	)
 	if err != nil {
-		return fmt.Errorf("failed to get deployment: %w", err)
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
 	}
 
 	// 获取所有关联的ReplicaSet
 	allRS, err := getAllAssociatedReplicaSets(client, deploy)
 	if err != nil {
-		return fmt.Errorf("failed to get replica sets: %w", err)
+		return nil, fmt.Errorf("failed to get replica sets: %w", err)
 	}
 
 	if len(allRS) < 2 {
-		return fmt.Errorf("not enough revision history (need at least 2, got %d)", len(allRS))
+		return nil, fmt.Errorf("not enough revision history (need at least 2, got %d)", len(allRS))
 	}
 
 	// 按版本号降序排序
 	sortReplicaSetsByRevision(allRS)
 
 	// 找到要回滚的目标版本（当前版本的上一个健康版本）
-	targetRS, err := findRollbackTarget(deploy, allRS)
+	targetRS, err := findRollbackTarget(deploy, allRS, opts)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	currentRev, _ := strconv.ParseInt(deploy.Annotations[deploymentRevisionAnnotation], 10, 64)
+	targetRev := int64(getRevision(*targetRS))
+	if err := opts.checkTarget(schemeDeployment, targetRS.Labels[appsv1.DefaultDeploymentUniqueLabelKey], targetRev); err != nil {
+		return nil, err
+	}
+	var currentHash string
+	for _, rs := range allRS {
+		if int64(getRevision(rs)) == currentRev {
+			currentHash = rs.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+		}
 	}
 
 	// 执行回滚操作
-	return performSafeRollback(client, deploy, targetRS)
+	updated, err := performSafeRollback(client, deploy, targetRS, currentRev, targetRev, opts.DryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RollbackResult{
+		Kind:         "Deployment",
+		Name:         deploy.Name,
+		Namespace:    deploy.Namespace,
+		FromRevision: currentRev,
+		ToRevision:   targetRev,
+		DryRun:       opts.DryRun,
+		Generation:   updated.Generation,
+		Diff:         templateDiff(deploy.Spec.Template, updated.Spec.Template),
+		Scheme:       schemeDeployment,
+		FromVersion:  currentHash,
+	}, nil
 }
 
 func getAllAssociatedReplicaSets(client kubernetes.Interface, deploy *appsv1.Deployment) ([]appsv1.ReplicaSet, error) {
@@ -144,22 +294,30 @@ func sortReplicaSetsByRevision(rsList []appsv1.ReplicaSet) {
 	})
 }
 
-// 查找回滚目标版本
-func findRollbackTarget(deploy *appsv1.Deployment, rsList []appsv1.ReplicaSet) (*appsv1.ReplicaSet, error) {
-	currentRev, _ := strconv.Atoi(deploy.Annotations["deployment.kubernetes.io/revision"])
-	if currentRev == -1 {
+// 查找回滚目标版本: 优先回滚到记录的最近稳定版本，没有记录时与 kubectl rollout undo 一致回滚到上一个版本
+// 被替换的ReplicaSet通常已缩容到0，不能以就绪副本数判断历史版本是否健康；本轮已回滚掉的模板不作为目标
+func findRollbackTarget(deploy *appsv1.Deployment, rsList []appsv1.ReplicaSet, opts RollbackOptions) (*appsv1.ReplicaSet, error) {
+	currentRev, err := strconv.Atoi(deploy.Annotations[deploymentRevisionAnnotation])
+	if err != nil {
 		return nil, fmt.Errorf("invalid current revision")
 	}
+	candidate := func(rs *appsv1.ReplicaSet) bool {
+		rev := getRevision(*rs)
+		return rev > 0 && rev < currentRev && !opts.skips(schemeDeployment, rs.Labels[appsv1.DefaultDeploymentUniqueLabelKey])
+	}
 
-	// 查找第一个健康的历史版本
-	for _, rs := range rsList {
-		rev := getRevision(rs)
-		if rev < currentRev && isHealthy(&rs) {
-			return &rs, nil
+	if rs := lastKnownGoodReplicaSet(deploy, rsList); rs != nil && candidate(rs) {
+		return rs, nil
+	}
+
+	// rsList已按版本降序排序
+	for i := range rsList {
+		if candidate(&rsList[i]) {
+			return &rsList[i], nil
 		}
 	}
 
-	return nil, fmt.Errorf("no healthy previous version available")
+	return nil, fmt.Errorf("no previous version available")
 }
 func getRevision(rs appsv1.ReplicaSet) int {
 	revStr := rs.Annotations["deployment.kubernetes.io/revision"]
@@ -173,23 +331,104 @@ func getRevision(rs appsv1.ReplicaSet) int {
 	return rev
 }
 
-// 检查RS是否健康
-func isHealthy(rs *appsv1.ReplicaSet) bool {
-	return rs.Status.ReadyReplicas > 0 &&
-		rs.Status.Replicas == rs.Status.ReadyReplicas
+// 安全回滚操作，与 kubectl rollout undo 一致: 去掉pod-template-hash标签、合并注解
+// 补丁携带resourceVersion，期间Deployment被修改时返回冲突，重试时重新读取Deployment与ReplicaSet
+func performSafeRollback(client kubernetes.Interface, deploy *appsv1.Deployment, targetRS *appsv1.ReplicaSet, from, to int64, dryRun bool) (*appsv1.Deployment, error) {
+	var updated *appsv1.Deployment
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := client.AppsV1().Deployments(deploy.Namespace).Get(context.TODO(), deploy.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		// 期间有新的发布时放弃回滚，避免覆盖他人的变更
+		if current.Annotations[deploymentRevisionAnnotation] != deploy.Annotations[deploymentRevisionAnnotation] {
+			return fmt.Errorf("deployment revision changed from %s to %s during rollback",
+				deploy.Annotations[deploymentRevisionAnnotation], current.Annotations[deploymentRevisionAnnotation])
+		}
+		if current.Spec.Paused {
+			return fmt.Errorf("deployment is paused, resume it before rolling back")
+		}
+
+		// 目标ReplicaSet可能已被清理或修改
+		allRS, err := getAllAssociatedReplicaSets(client, current)
+		if err != nil {
+			return err
+		}
+		var target *appsv1.ReplicaSet
+		for i := range allRS {
+			if allRS[i].Name == targetRS.Name && int64(getRevision(allRS[i])) == to {
+				target = &allRS[i]
+			}
+		}
+		if target == nil {
+			return fmt.Errorf("target replica set %s (revision %d) no longer exists", targetRS.Name, to)
+		}
+
+		patch, err := deploymentRollbackPatch(current, target, from, to)
+		if err != nil {
+			return err
+		}
+		updated, err = client.AppsV1().Deployments(deploy.Namespace).Patch(
+			context.TODO(),
+			deploy.Name,
+			types.JSONPatchType,
+			patch,
+			metav1.PatchOptions{DryRun: dryRunOption(dryRun)},
+		)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to patch deployment: %w", err)
+	}
+	return updated, nil
 }
 
-// 安全回滚操作
-func performSafeRollback(client kubernetes.Interface, deploy *appsv1.Deployment, targetRS *appsv1.ReplicaSet) error {
-	// 创建更新对象
-	newDeploy := deploy.DeepCopy()
+// 生成回滚Deployment的JSON Patch: 替换Pod模板与注解，以读取时的resourceVersion作为前置条件
+func deploymentRollbackPatch(deploy *appsv1.Deployment, targetRS *appsv1.ReplicaSet, from, to int64) ([]byte, error) {
+	template := targetRS.Spec.Template.DeepCopy()
+	delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
 
-	// 回滚模板配置
-	newDeploy.Spec.Template = targetRS.Spec.Template
-	_, err := client.AppsV1().Deployments(deploy.Namespace).Update(
-		context.TODO(),
-		newDeploy,
-		metav1.UpdateOptions{},
-	)
-	return err
+	// 控制器维护的注解与PodSentry的注解保留Deployment当前的值，其余注解恢复为目标版本的值
+	annotations := make(map[string]string)
+	for key, value := range deploy.Annotations {
+		if deploymentAnnotationsToSkip[key] || strings.HasPrefix(key, podSentryAnnotationPrefix) {
+			annotations[key] = value
+		}
+	}
+	for key, value := range targetRS.Annotations {
+		if !deploymentAnnotationsToSkip[key] && !strings.HasPrefix(key, podSentryAnnotationPrefix) {
+			annotations[key] = value
+		}
+	}
+	for key, value := range rollbackAnnotations(from, to) {
+		annotations[key] = value
+	}
+
+	return json.Marshal([]map[string]interface{}{
+		{"op": "replace", "path": "/spec/template", "value": template},
+		{"op": "add", "path": "/metadata/annotations", "value": annotations},
+		{"op": "add", "path": "/metadata/resourceVersion", "value": deploy.ResourceVersion},
+	})
+}
+
+// 回滚时记录的注解
+func rollbackAnnotations(from, to int64) map[string]string {
+	return map[string]string{
+		changeCauseAnnotation:    fmt.Sprintf("PodSentry rolled back from revision %d to %d", from, to),
+		AnnotationRolledBackFrom: strconv.FormatInt(from, 10),
+		AnnotationRolledBackTo:   strconv.FormatInt(to, 10),
+	}
+}
+
+// 在ControllerRevision的补丁中加入回滚注解，并以resourceVersion作为前置条件
+func withRollbackAnnotations(patch []byte, resourceVersion string, from, to int64) ([]byte, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(patch, &data); err != nil {
+		return nil, fmt.Errorf("invalid revision data: %w", err)
+	}
+	data["metadata"] = map[string]interface{}{
+		"annotations":     rollbackAnnotations(from, to),
+		"resourceVersion": resourceVersion,
+	}
+	return json.Marshal(data)
 }
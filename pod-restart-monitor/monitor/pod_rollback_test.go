@@ -0,0 +1,236 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func podTemplate(image string) v1.PodTemplateSpec {
+	return v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: image}}},
+	}
+}
+
+// Deployment web当前为版本3，保留版本1到3的ReplicaSet，hash-N对应版本N的模板
+func deploymentHistory(annotations map[string]string) []runtime.Object {
+	deployAnnotations := map[string]string{deploymentRevisionAnnotation: "3", "team": "payments"}
+	for key, value := range annotations {
+		deployAnnotations[key] = value
+	}
+	objects := []runtime.Object{&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Annotations: deployAnnotations},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			Template: podTemplate("web:v3"),
+		},
+	}}
+	for revision := 1; revision <= 3; revision++ {
+		hash := "hash-" + strconv.Itoa(revision)
+		template := podTemplate("web:v" + strconv.Itoa(revision))
+		template.Labels[appsv1.DefaultDeploymentUniqueLabelKey] = hash
+		objects = append(objects, &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "web-" + hash,
+				Namespace:   "default",
+				Labels:      template.Labels,
+				Annotations: map[string]string{deploymentRevisionAnnotation: strconv.Itoa(revision), "team": "team-" + strconv.Itoa(revision)},
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "apps/v1", Kind: "Deployment", Name: "web", Controller: boolPtr(true)},
+				},
+			},
+			Spec: appsv1.ReplicaSetSpec{Template: template},
+		})
+	}
+	return objects
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func crashingDeploymentPod() *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "web-hash-3-abcde",
+		Namespace: "default",
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-hash-3", Controller: boolPtr(true)},
+		},
+	}}
+}
+
+func TestDeploymentRollbackPatch(t *testing.T) {
+	deploy := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{ResourceVersion: "42", Annotations: map[string]string{
+		deploymentRevisionAnnotation: "3",
+		AnnotationRollbackState:      `{"history":[]}`,
+		"team":                       "payments",
+	}}}
+	template := podTemplate("web:v1")
+	template.Labels[appsv1.DefaultDeploymentUniqueLabelKey] = "hash-1"
+	target := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+			deploymentRevisionAnnotation: "1",
+			"team":                       "platform",
+		}},
+		Spec: appsv1.ReplicaSetSpec{Template: template},
+	}
+
+	data, err := deploymentRollbackPatch(deploy, target, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var patch []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &patch); err != nil {
+		t.Fatal(err)
+	}
+	if len(patch) != 3 || patch[0].Path != "/spec/template" || patch[1].Path != "/metadata/annotations" {
+		t.Fatalf("unexpected patch %s", data)
+	}
+	// resourceVersion作为前置条件，并发修改时返回冲突
+	if patch[2].Path != "/metadata/resourceVersion" || string(patch[2].Value) != `"42"` {
+		t.Errorf("resourceVersion precondition = %s %s, want \"42\"", patch[2].Path, patch[2].Value)
+	}
+
+	var patched v1.PodTemplateSpec
+	if err := json.Unmarshal(patch[0].Value, &patched); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := patched.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; exists {
+		t.Error("pod-template-hash label must be removed from the template")
+	}
+	if patched.Spec.Containers[0].Image != "web:v1" {
+		t.Errorf("template image = %s, want web:v1", patched.Spec.Containers[0].Image)
+	}
+	if _, exists := template.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; !exists {
+		t.Error("target replica set template was modified")
+	}
+
+	var annotations map[string]string
+	if err := json.Unmarshal(patch[1].Value, &annotations); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		deploymentRevisionAnnotation: "3",              // 控制器维护的注解保留当前值
+		AnnotationRollbackState:      `{"history":[]}`, // PodSentry的注解保留当前值
+		"team":                       "platform",       // 其余注解恢复为目标版本
+		AnnotationRolledBackFrom:     "3",
+		AnnotationRolledBackTo:       "1",
+		changeCauseAnnotation:        "PodSentry rolled back from revision 3 to 1",
+	}
+	for key, value := range want {
+		if annotations[key] != value {
+			t.Errorf("annotation %s = %q, want %q", key, annotations[key], value)
+		}
+	}
+}
+
+func TestPodRollbackDeployment(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		opts        RollbackOptions
+		wantTo      int64
+		wantErr     error
+	}{
+		{name: "previous revision", wantTo: 2},
+		{name: "skips rolled back template", opts: RollbackOptions{Scheme: schemeDeployment, RolledBackFrom: []string{"hash-2"}}, wantTo: 1},
+		{name: "rolled back versions of another scheme are ignored", opts: RollbackOptions{Scheme: schemeHelm, RolledBackFrom: []string{"hash-2"}}, wantTo: 2},
+		{name: "last known good", annotations: map[string]string{AnnotationLastKnownGoodHash: "hash-1"}, wantTo: 1},
+		{name: "min revision", opts: RollbackOptions{MinRevision: 2}, wantTo: 2},
+		{name: "below min revision", opts: RollbackOptions{MinRevision: 3}, wantErr: errRollbackDepth},
+		{
+			name:    "max depth reached",
+			opts:    RollbackOptions{Scheme: schemeDeployment, RolledBackFrom: []string{"hash-4"}, MaxDepth: 1},
+			wantErr: errRollbackDepth,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset(deploymentHistory(tt.annotations)...)
+			result, err := PodRollback(crashingDeploymentPod(), client, tt.opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.FromRevision != 3 || result.ToRevision != tt.wantTo {
+				t.Errorf("rolled back %d -> %d, want 3 -> %d", result.FromRevision, result.ToRevision, tt.wantTo)
+			}
+			if result.Scheme != schemeDeployment || result.FromVersion != "hash-3" {
+				t.Errorf("scheme/from version = %s/%s, want %s/hash-3", result.Scheme, result.FromVersion, schemeDeployment)
+			}
+
+			deploy, err := client.AppsV1().Deployments("default").Get(context.TODO(), "web", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantImage := "web:v" + strconv.FormatInt(tt.wantTo, 10)
+			if image := deploy.Spec.Template.Spec.Containers[0].Image; image != wantImage {
+				t.Errorf("deployment image = %s, want %s", image, wantImage)
+			}
+			if deploy.Annotations["team"] != "team-"+strconv.FormatInt(tt.wantTo, 10) {
+				t.Errorf("annotations not restored: %v", deploy.Annotations)
+			}
+			if deploy.Annotations[deploymentRevisionAnnotation] != "3" {
+				t.Errorf("revision annotation changed: %v", deploy.Annotations)
+			}
+		})
+	}
+}
+
+func TestPodRollbackRefusesPausedDeployment(t *testing.T) {
+	objects := deploymentHistory(nil)
+	objects[0].(*appsv1.Deployment).Spec.Paused = true
+	client := fake.NewClientset(objects...)
+	if _, err := PodRollback(crashingDeploymentPod(), client, RollbackOptions{}); err == nil {
+		t.Fatal("expected paused deployment to be refused")
+	}
+}
+
+func TestPodRollbackRereadsOnConflict(t *testing.T) {
+	client := fake.NewClientset(deploymentHistory(nil)...)
+	// 第一次提交补丁前有新的发布，apiserver因resourceVersion不一致返回冲突
+	conflicts := 0
+	client.PrependReactor("patch", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			return false, nil, nil
+		}
+		conflicts++
+		deploy, err := client.Tracker().Get(appsv1.SchemeGroupVersion.WithResource("deployments"), "default", "web")
+		if err != nil {
+			return true, nil, err
+		}
+		deploy.(*appsv1.Deployment).Annotations[deploymentRevisionAnnotation] = "4"
+		if err := client.Tracker().Update(appsv1.SchemeGroupVersion.WithResource("deployments"), deploy, "default"); err != nil {
+			return true, nil, err
+		}
+		return true, nil, apierrors.NewConflict(appsv1.Resource("deployments"), "web", errors.New("the object has been modified"))
+	})
+
+	_, err := PodRollback(crashingDeploymentPod(), client, RollbackOptions{})
+	if err == nil || !strings.Contains(err.Error(), "revision changed from 3 to 4") {
+		t.Fatalf("err = %v, want revision changed", err)
+	}
+	if conflicts != 1 {
+		t.Errorf("conflicts = %d, want 1", conflicts)
+	}
+}
@@ -1,177 +1,759 @@
 package monitor
 
 import (
+	"context"
 	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
 	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/notify"
+	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
+// PodRecord 按顶层工作负载聚合的重启记录，裸Pod单独成一条记录
 type PodRecord struct {
-	PodName          string
-	Namespace        string
-	FirstDetected    time.Time
-	LastRestart      time.Time
-	RestartCount     int // 时间窗口内的重启次数
-	RealRestartCount int // 记录的实际重启次数（如容器重启次数的最大值）
+	WorkloadKind  string
+	WorkloadName  string
+	PodName       string // 最近一次重启的Pod
+	Namespace     string
+	FirstDetected time.Time
+	LastRestart   time.Time
+	LastTriggered time.Time      // 最近一次触发告警/回滚的时间
+	RestartCount  int            // 滑动时间窗口内所有副本的重启次数
+	Restarts      []RestartEvent // 滑动时间窗口内的每次重启，按容器终止时间升序
+	Replicas      int32          // 工作负载期望副本数
+	TimeWindow    time.Duration
+	Pods          map[string]PodState        // 按Pod UID记录各副本状态
+	Containers    map[string]ContainerRecord // 按容器名记录，包括init容器与sidecar
+	Findings      map[string][]Finding       // 按检测器记录滑动时间窗口内的异常
+	LastFinding   time.Time
+	Events        []EventSummary // 相关Pod的近期事件
+	ProbableCause ProbableCause  // 最近一次触发时推断的崩溃原因
+}
+
+// PodState 单个副本的状态
+type PodState struct {
+	PodName           string
+	ContainerRestarts map[string]int32 // 各容器上次观察到的RestartCount
+	CrashLooping      bool
+	NodeName          string
+	Revision          string // controller-revision-hash 或 pod-template-hash
 }
 
 type PodWatcher struct {
-	client    kubernetes.Interface
-	config    *config.Config
-	records   map[string]PodRecord
-	recordsMu sync.RWMutex
+	client         kubernetes.Interface
+	dynamic        dynamic.Interface // 用于回滚Helm Release
+	config         *config.Config
+	detectors      []Detector
+	events         *EventIndex
+	records        map[string]PodRecord       // key: 工作负载标识，见recordKey
+	podIndex       map[string]string          // Pod UID -> 记录key
+	activeFindings map[string]map[string]bool // Pod UID -> 当前仍存在的异常Key
+	approvals      *approvalManager
+	remediators    map[string]Remediator
+	stable         map[string]stableCandidate // 正在观察的Deployment版本，与records共用锁
+	ladders        map[string]ladderState     // 升级阶梯进度，与records共用锁，key同records
+	killSwitch     killSwitch
+	recordsMu      sync.RWMutex
+	listers        map[string]*workloadListers // 命名空间 -> informer缓存，由PodInformerManager注册
+	namespaces     corelisters.NamespaceLister
+	listersMu      sync.RWMutex
+	ctx            context.Context // 退出时取消，用于后台的滚动验证与定时器
+	cancel         context.CancelFunc
 }
 
-func NewPodWatcher(client kubernetes.Interface, cfg *config.Config) *PodWatcher {
+func NewPodWatcher(client kubernetes.Interface, dynamicClient dynamic.Interface, cfg *config.Config) *PodWatcher {
 	logrus.Info("PodWatcher created")
+	ctx, cancel := context.WithCancel(context.Background())
 	return &PodWatcher{
-		client:  client,
-		config:  cfg,
-		records: make(map[string]PodRecord),
+		client:         client,
+		dynamic:        dynamicClient,
+		config:         cfg,
+		detectors:      newDetectors(cfg),
+		events:         NewEventIndex(cfg.EventReasons),
+		records:        make(map[string]PodRecord),
+		podIndex:       make(map[string]string),
+		activeFindings: make(map[string]map[string]bool),
+		approvals:      newApprovalManager(),
+		remediators:    newRemediators(cfg),
+		stable:         make(map[string]stableCandidate),
+		ladders:        make(map[string]ladderState),
+		listers:        make(map[string]*workloadListers),
+		ctx:            ctx,
+		cancel:         cancel,
 	}
 }
 
+// Shutdown 停止后台的滚动验证、审批定时器与稳定版本观察
+func (w *PodWatcher) Shutdown() {
+	w.cancel()
+	w.approvals.stop()
+	w.stopStableCandidates()
+}
+
 func HandlePodEvent(w *PodWatcher, pod *v1.Pod) {
-	if !isCrashLooping(pod) || !isRestartEvent(pod) {
+	now := time.Now()
+	findings := w.newFindings(pod, now)
+	crashLooping := isCrashLooping(pod) && isRestartEvent(pod)
+	if !crashLooping {
+		w.markRecovered(pod)
+		if len(findings) == 0 {
+			return
+		}
+	}
+
+	workload, err := w.resolveWorkload(pod)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"podName":   pod.Name,
+			"namespace": pod.Namespace,
+		}).WithError(err).Warn("Failed to resolve pod workload")
+	}
+	policy := w.resolvePolicy(pod, workload)
+	if policy.Ignore {
+		logrus.Debugf("Pod %s/%s ignored by annotation", pod.Namespace, pod.Name)
 		return
 	}
-	podUID := string(pod.UID)
-	now := time.Now()
 
-	w.checkRecord(pod, podUID, now)
-	if w.config.Rollback && w.getRecord(podUID).RestartCount == 1 {
-		w.sendFirestRestartMessage(pod)
+	key := recordKey(pod, workload)
+	if crashLooping {
+		w.handleCrashLoop(pod, key, workload, policy, now)
 	}
-	if record := w.getRecord(podUID); record.RestartCount >= w.config.Threshold {
-		w.handleRestartThreshold(pod, podUID, now)
+	if len(findings) > 0 {
+		w.handleFindings(pod, key, workload, policy, findings, now)
 	}
 }
 
-func (w *PodWatcher) checkRecord(pod *v1.Pod, podUID string, now time.Time) {
+func (w *PodWatcher) handleCrashLoop(pod *v1.Pod, key string, workload *Workload, policy Policy, now time.Time) {
+	// 只有被过滤掉的容器在CrashLoopBackOff时视为未异常
+	if len(crashLoopingContainers(pod, policy)) == 0 {
+		w.markRecovered(pod)
+		return
+	}
 
+	counted := w.checkRecord(key, pod, workload, now, policy)
+	record := w.getRecord(key)
+	if counted && policy.rollbackEnabled() && record.RestartCount == 1 {
+		w.sendFirestRestartMessage(pod, record, policy)
+	}
+	if len(policy.Ladder) > 0 {
+		if counted {
+			w.climbLadder(pod, key, record, policy, now)
+		}
+		return
+	}
+	if reason, reached := thresholdReached(record, policy, now); reached {
+		w.handleRestartThreshold(pod, key, now, policy, reason)
+	}
+}
+
+// HandlePodDelete Pod删除后移除其副本状态
+func HandlePodDelete(w *PodWatcher, pod *v1.Pod) {
 	w.recordsMu.Lock()
 	defer w.recordsMu.Unlock()
 
-	record, exists := w.records[podUID]
+	// 异常与事件不依赖重启记录，未重启过的Pod也要清理
+	podUID := string(pod.UID)
+	delete(w.activeFindings, podUID)
+	w.events.Delete(podUID)
+	key, exists := w.podIndex[podUID]
+	if !exists {
+		return
+	}
+	delete(w.podIndex, podUID)
+	if record, exists := w.records[key]; exists {
+		delete(record.Pods, podUID)
+		w.records[key] = record
+	}
+}
+
+// 工作负载记录的key，裸Pod使用UID
+func recordKey(pod *v1.Pod, workload *Workload) string {
+	if workload == nil {
+		return fmt.Sprintf("Pod/%s/%s", pod.Namespace, pod.UID)
+	}
+	return fmt.Sprintf("%s/%s/%s", workload.Kind, workload.Namespace, workload.Name)
+}
+
+// 更新记录，返回本次是否统计到了新的重启
+func (w *PodWatcher) checkRecord(key string, pod *v1.Pod, workload *Workload, now time.Time, policy Policy) bool {
+
+	w.recordsMu.Lock()
+	defer w.recordsMu.Unlock()
+
+	record, exists := w.records[key]
 
 	if !exists {
-		record = w.createNewRecord(pod, now, getRealRestartCount(pod))
-		logNewRecord(pod, podUID, now)
-	} else {
-		record = w.updateExistingRecord(record, now, getRealRestartCount(pod))
+		record = w.createNewRecord(pod, workload, now)
+		logNewRecord(pod, key, now)
+	}
+	record.TimeWindow = policy.TimeWindow
+	if workload != nil {
+		record.Replicas = workload.Replicas
+	}
+
+	// 按容器终止时间统计每一次新增的重启
+	podUID := string(pod.UID)
+	state, podExists := record.Pods[podUID]
+	record.updateContainers(pod, policy)
+	restarts := newRestarts(pod, state.ContainerRestarts, !podExists, now, policy)
+	added := record.addRestarts(restarts, now)
+	counted := added > 0
+	if counted {
+		record.PodName = pod.Name
+		if len(policy.Ladder) > 0 {
+			w.countLadderRestarts(key, added, now, policy)
+		}
 	}
-	w.records[podUID] = record
 
+	record.Pods[podUID] = PodState{
+		PodName:           pod.Name,
+		ContainerRestarts: containerRestartCounts(pod),
+		CrashLooping:      true,
+		NodeName:          pod.Spec.NodeName,
+		Revision:          podRevision(pod),
+	}
+	record.Events = mergeEvents(record.Events, w.events.Recent(podUID), maxEventsPerRecord)
+	w.records[key] = record
+	w.podIndex[podUID] = key
+	return counted
 }
-func (w *PodWatcher) createNewRecord(pod *v1.Pod, now time.Time, currentRealRestart int) PodRecord {
-	return PodRecord{
-		PodName:          pod.Name,
-		Namespace:        pod.Namespace,
-		FirstDetected:    now,
-		LastRestart:      now,
-		RestartCount:     1,
-		RealRestartCount: currentRealRestart,
+
+func (w *PodWatcher) createNewRecord(pod *v1.Pod, workload *Workload, now time.Time) PodRecord {
+	record := PodRecord{
+		WorkloadKind:  "Pod",
+		WorkloadName:  pod.Name,
+		PodName:       pod.Name,
+		Namespace:     pod.Namespace,
+		FirstDetected: now,
+		LastRestart:   now,
+		Replicas:      1,
+		Pods:          make(map[string]PodState),
+		Containers:    make(map[string]ContainerRecord),
+		Findings:      make(map[string][]Finding),
+	}
+	if workload != nil {
+		record.WorkloadKind = workload.Kind
+		record.WorkloadName = workload.Name
 	}
+	return record
 }
 
-func (w *PodWatcher) updateExistingRecord(record PodRecord, now time.Time, currentRealRestart int) PodRecord {
-	if currentRealRestart > record.RealRestartCount {
-		if now.Sub(record.FirstDetected) <= w.config.TimeWindow {
-			record.RestartCount++
-		} else {
-			record.RestartCount = 1
-			record.FirstDetected = now
+// Pod不再处于CrashLoopBackOff时更新其副本状态，重启计数基线保持不变，
+// 再次进入CrashLoopBackOff时期间的重启同样会被统计
+func (w *PodWatcher) markRecovered(pod *v1.Pod) {
+	w.recordsMu.Lock()
+	defer w.recordsMu.Unlock()
+
+	podUID := string(pod.UID)
+	key, exists := w.podIndex[podUID]
+	if !exists {
+		return
+	}
+	if record, exists := w.records[key]; exists {
+		if state, exists := record.Pods[podUID]; exists && state.CrashLooping {
+			state.CrashLooping = false
+			record.Pods[podUID] = state
+			w.records[key] = record
 		}
-		record.LastRestart = now
-		record.RealRestartCount = currentRealRestart
 	}
-	return record
 }
 
-func (w *PodWatcher) resetRecord(podUID string, now time.Time, pod *v1.Pod) {
+// 判断是否达到触发条件，返回触发原因
+func thresholdReached(record PodRecord, policy Policy, now time.Time) (string, bool) {
+	if record.RestartCount >= policy.Threshold {
+		return fmt.Sprintf("%d restarts across %d replicas within %s",
+			record.RestartCount, len(record.Pods), policy.TimeWindow), true
+	}
+
+	// 副本维度的规则在一个时间窗口内只触发一次
+	if policy.CrashLoopReplicas > 0 && now.Sub(record.LastTriggered) > policy.TimeWindow {
+		if crashLooping := record.crashLoopingReplicas(); crashLooping >= policy.CrashLoopReplicas {
+			return fmt.Sprintf("%d of %d replicas in CrashLoopBackOff",
+				crashLooping, record.Replicas), true
+		}
+	}
+	// DaemonSet同一版本在多个节点上崩溃
+	if record.WorkloadKind == "DaemonSet" && policy.CrashLoopNodes > 0 && now.Sub(record.LastTriggered) > policy.TimeWindow {
+		if revision, nodes := record.crashLoopingNodes(); nodes >= policy.CrashLoopNodes {
+			return fmt.Sprintf("%d nodes in CrashLoopBackOff on revision %s", nodes, revision), true
+		}
+	}
+	return "", false
+}
+
+// 按版本统计处于CrashLoopBackOff的节点数，返回节点数最多的版本
+func (r PodRecord) crashLoopingNodes() (string, int) {
+	nodesByRevision := make(map[string]map[string]bool)
+	for _, state := range r.Pods {
+		if !state.CrashLooping || state.NodeName == "" {
+			continue
+		}
+		if nodesByRevision[state.Revision] == nil {
+			nodesByRevision[state.Revision] = make(map[string]bool)
+		}
+		nodesByRevision[state.Revision][state.NodeName] = true
+	}
+
+	maxRevision, maxNodes := "", 0
+	for revision, nodes := range nodesByRevision {
+		if len(nodes) > maxNodes {
+			maxRevision, maxNodes = revision, len(nodes)
+		}
+	}
+	return maxRevision, maxNodes
+}
+
+func podRevision(pod *v1.Pod) string {
+	if hash := pod.Labels[appsv1.ControllerRevisionHashLabelKey]; hash != "" {
+		return hash
+	}
+	return pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+}
+
+func (r PodRecord) crashLoopingReplicas() int {
+	count := 0
+	for _, state := range r.Pods {
+		if state.CrashLooping {
+			count++
+		}
+	}
+	return count
+}
+
+// 工作负载的展示名称
+func (r PodRecord) Workload() string {
+	return r.WorkloadKind + "/" + r.WorkloadName
+}
+
+func (w *PodWatcher) resetRecord(key string, now time.Time) {
 	w.recordsMu.Lock()
 	defer w.recordsMu.Unlock()
 
-	if record, exists := w.records[podUID]; exists {
-		currentRealRestart := getRealRestartCount(pod)
+	if record, exists := w.records[key]; exists {
 		record.RestartCount = 0
+		record.Restarts = nil
 		record.FirstDetected = now
 		record.LastRestart = now
-		record.RealRestartCount = currentRealRestart
-		w.records[podUID] = record
+		record.LastTriggered = now
+		w.records[key] = record
 	}
 }
-func (w *PodWatcher) handleRestartThreshold(pod *v1.Pod, podUID string, now time.Time) {
-	if w.config.Rollback {
-		w.rollback(pod, podUID, now)
-	} else {
-		w.notify(pod, podUID, now)
+func (w *PodWatcher) handleRestartThreshold(pod *v1.Pod, key string, now time.Time, policy Policy, reason string) {
+	record := w.getRecord(key)
+	logrus.WithFields(logrus.Fields{
+		"workload":  record.Workload(),
+		"namespace": record.Namespace,
+		"reason":    reason,
+	}).Info("Workload reached restart threshold")
+
+	// 回滚前获取日志，回滚后Pod可能已被删除
+	logTail := w.fetchLogTail(record)
+	record.ProbableCause = w.classifyCause(record, logTail)
+	w.setProbableCause(key, record.ProbableCause)
+
+	switch {
+	case policy.rollbackEnabled() && policy.Remediation == config.RemediationRollback &&
+		record.ProbableCause.skipsRollback(policy.RollbackSkipCause):
+		reason = fmt.Sprintf("%s, rollback skipped because probable cause is %s", reason, record.ProbableCause)
+		logrus.WithFields(logrus.Fields{
+			"workload": record.Workload(),
+			"cause":    record.ProbableCause.String(),
+		}).Info("Rollback skipped by probable cause")
+		w.notify(key, now, policy, record, reason, logTail)
+	case policy.rollbackEnabled():
+		w.remediate(pod, key, now, policy, record, logTail)
+	default:
+		w.notify(key, now, policy, record, reason, logTail)
 	}
 }
 
-func (w *PodWatcher) rollback(pod *v1.Pod, podUID string, now time.Time) {
-	err := PodRollback(pod, w.client)
-	message := "Pod rollback successful"
+// 按策略执行处置动作，回滚有单独的回滚限制与滚动验证流程；演练与审批模式同样适用
+func (w *PodWatcher) remediate(pod *v1.Pod, key string, now time.Time, policy Policy, record PodRecord, logTail *LogTail) {
+	if policy.Remediation == "" || policy.Remediation == config.RemediationRollback {
+		w.rollback(pod, key, now, policy, record, logTail)
+		return
+	}
+
+	w.resetRecord(key, now)
+	if reason := w.guardrailReason(record.Namespace, now); reason != "" {
+		w.blockByGuardrail(pod, record, policy, reason, logTail)
+		return
+	}
+	remediator, exists := w.remediators[policy.Remediation]
+	if !exists {
+		logrus.WithField("remediation", policy.Remediation).Error("Unknown remediation")
+		return
+	}
+
+	// 处置动作与回滚共用回滚限制，避免每次达到阈值都重复执行
+	limits := w.config.RollbackLimits
+	state, err := w.loadRollbackState(record)
+	if errors.Is(err, errUnsupportedWorkload) {
+		logrus.WithField("workload", record.Workload()).Warn("Remediation is not supported for workload kind")
+		w.sendRollbackMessage(pod, record, fmt.Sprintf("Remediation %s is not supported for kind %s, notify only", remediator.Name(), record.WorkloadKind), "", policy, logTail)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to load rollback state")
+		w.sendRollbackMessage(pod, record, fmt.Sprintf("Remediation %s skipped, notify only: %v", remediator.Name(), err), "", policy, logTail)
+		return
+	}
+	state.prune(now, limits)
+	if reason, openCircuit := state.check(now, limits); reason != "" {
+		w.blockRollback(pod, record, policy, state, reason, openCircuit, now, logTail)
+		return
+	}
+	if policy.rollbackApproval() {
+		w.requestApproval(pod, key, record, policy, logTail, now)
+		return
+	}
+	target := RemediationTarget{
+		Pod:       pod,
+		Kind:      record.WorkloadKind,
+		Name:      record.WorkloadName,
+		Namespace: record.Namespace,
+		Reason:    record.ProbableCause.String(),
+	}
+	outcome, err := remediator.Remediate(w.client, target, policy.rollbackDryRun())
+
+	var message string
+	switch {
+	case err != nil:
+		message = fmt.Sprintf("Remediation %s failed: %v", remediator.Name(), err)
+		logrus.WithError(err).WithField("remediation", remediator.Name()).Error("Remediation failed")
+	case policy.rollbackDryRun():
+		message = fmt.Sprintf("Dry run: remediation %s would succeed: %s", remediator.Name(), outcome)
+	default:
+		message = fmt.Sprintf("Remediation %s succeeded: %s", remediator.Name(), outcome)
+		logrus.WithFields(logrus.Fields{
+			"workload":    record.Workload(),
+			"remediation": remediator.Name(),
+		}).Info(outcome)
+		state.recordAction(now, remediator.Name())
+		if err := w.saveRollbackState(record, state); err != nil {
+			logrus.WithError(err).Error("Failed to save rollback state")
+		}
+	}
+	w.sendRollbackMessage(pod, record, message, "", policy, logTail)
+}
+
+func (w *PodWatcher) setProbableCause(key string, cause ProbableCause) {
+	w.recordsMu.Lock()
+	defer w.recordsMu.Unlock()
+
+	if record, exists := w.records[key]; exists {
+		record.ProbableCause = cause
+		w.records[key] = record
+	}
+}
+
+func (w *PodWatcher) rollback(pod *v1.Pod, key string, now time.Time, policy Policy, record PodRecord, logTail *LogTail) {
+	if reason := w.guardrailReason(record.Namespace, now); reason != "" {
+		w.resetRecord(key, now)
+		w.blockByGuardrail(pod, record, policy, reason, logTail)
+		return
+	}
+	if !rollbackSupported(record.WorkloadKind) {
+		w.resetRecord(key, now)
+		w.sendRollbackMessage(pod, record, fmt.Sprintf("Rollback is not supported for kind %s, notify only", record.WorkloadKind), "", policy, logTail)
+		return
+	}
+	limits := w.config.RollbackLimits
+	state, err := w.loadRollbackState(record)
 	if err != nil {
+		// 无法确认回滚历史时不回滚
+		logrus.WithError(err).Error("Failed to load rollback state")
+		w.resetRecord(key, now)
+		w.sendRollbackMessage(pod, record, fmt.Sprintf("Rollback skipped, notify only: %v", err), "", policy, logTail)
+		return
+	}
+	state.prune(now, limits)
+	if reason, openCircuit := state.check(now, limits); reason != "" {
+		w.resetRecord(key, now)
+		w.blockRollback(pod, record, policy, state, reason, openCircuit, now, logTail)
+		return
+	}
+
+	// 审批模式在批准后以自动回滚模式重新进入本流程
+	if policy.rollbackApproval() {
+		w.resetRecord(key, now)
+		w.requestApproval(pod, key, record, policy, logTail, now)
+		return
+	}
+
+	result, err := w.rollbackWorkload(pod, record, state.options(policy.rollbackDryRun(), limits, policy.MinRevision))
+	var message, diff string
+	switch {
+	case errors.Is(err, errRollbackDepth):
+		w.resetRecord(key, now)
+		w.blockRollback(pod, record, policy, state, err.Error(), true, now, logTail)
+		return
+	case errors.Is(err, errHelmManaged) || errors.Is(err, errGitOpsManaged):
+		message = fmt.Sprintf("Rollback refused: %v", err)
+		logrus.WithField("workload", record.Workload()).Warn("Rollback refused for helm or gitops managed workload")
+		w.resetRecord(key, now)
+	case err != nil && policy.rollbackDryRun():
+		message = fmt.Sprintf("Dry run rollback failed: %v", err)
+		logrus.WithError(err).Error("Dry run rollback failed")
+	case err != nil:
 		message = fmt.Sprintf("Pod rollback failed: %v", err)
 		logrus.WithError(err).Error("Rollback failed")
-	} else {
-		w.resetRecord(podUID, now, pod)
+	case result.DryRun:
+		// 演练模式同样重置记录，避免同一故障重复演练
+		message = fmt.Sprintf("Dry run: would roll back %s from revision %d to %d",
+			result.Subject(), result.FromRevision, result.ToRevision)
+		diff = result.Diff
+		w.resetRecord(key, now)
+	default:
+		// 更新被接受不代表回滚成功，后台跟踪滚动并发送最终结果
+		message = fmt.Sprintf("Pod rollback submitted: %s rolling back from revision %d to %d, verifying rollout",
+			result.Subject(), result.FromRevision, result.ToRevision)
+		w.resetRecord(key, now)
+		state.record(now, result)
+		if err := w.saveRollbackState(record, state); err != nil {
+			logrus.WithError(err).Error("Failed to save rollback state")
+		}
+		go w.verifyRollout(pod, record, policy, result, now)
+	}
+	if result != nil && result.Note != "" {
+		message = fmt.Sprintf("%s; %s", message, result.Note)
+	}
+	w.sendRollbackMessage(pod, record, message, diff, policy, logTail)
+}
+
+// 回滚被限制时只通知；达到限制则打开熔断并发送熔断告警
+func (w *PodWatcher) blockRollback(pod *v1.Pod, record PodRecord, policy Policy, state *RollbackState, reason string, openCircuit bool, now time.Time, logTail *LogTail) {
+	logrus.WithFields(logrus.Fields{
+		"workload":    record.Workload(),
+		"namespace":   record.Namespace,
+		"reason":      reason,
+		"openCircuit": openCircuit,
+	}).Warn("Rollback blocked")
+
+	action := "Rollback"
+	if policy.Remediation != "" && policy.Remediation != config.RemediationRollback {
+		action = "Remediation " + policy.Remediation
+	}
+	message := fmt.Sprintf("%s skipped, notify only: %s", action, reason)
+	switch {
+	case policy.rollbackDryRun():
+		message = fmt.Sprintf("Dry run: %s would be blocked: %s", strings.ToLower(action), reason)
+	case openCircuit:
+		state.openCircuit(now, reason, w.config.RollbackLimits)
+		if err := w.saveRollbackState(record, state); err != nil {
+			logrus.WithError(err).Error("Failed to save rollback state")
+		}
+		message = fmt.Sprintf("Rollback circuit OPEN for %s: %s. Notify only until %s, remove annotation %s from the workload to reset",
+			record.Workload(), reason, state.CircuitOpenUntil.Format("2006-01-02 15:04:05"), AnnotationRollbackState)
+	}
+	w.sendRollbackMessage(pod, record, message, "", policy, logTail)
+}
+
+func (w *PodWatcher) notify(key string, now time.Time, policy Policy, record PodRecord, reason string, logTail *LogTail) {
+	w.resetRecord(key, now)
+	w.sendRestartMessage(record, policy, reason, logTail)
+}
+
+// 处理检测器发现的异常，达到检测器阈值后告警，可回滚的异常在开启回滚时执行回滚
+func (w *PodWatcher) handleFindings(pod *v1.Pod, key string, workload *Workload, policy Policy, findings []Finding, now time.Time) {
+	reached := w.recordFindings(key, pod, workload, policy, findings, now)
+	for name, inWindow := range reached {
+		detector := w.detectorByName(name)
+		record := w.getRecord(key)
+		logrus.WithFields(logrus.Fields{
+			"workload":  record.Workload(),
+			"namespace": record.Namespace,
+			"detector":  name,
+			"count":     len(inWindow),
+		}).Info("Workload reached detector threshold")
+
+		// 与重启达到阈值相同，按处置动作与可能原因处理；配置了升级阶梯时由重启次数驱动升级，异常只通知
+		if policy.rollbackEnabled() && len(policy.Ladder) == 0 && detector != nil && detector.Rollbackable() {
+			w.handleRestartThreshold(pod, key, now, policy, fmt.Sprintf("detector %s found %d times", name, len(inWindow)))
+			continue
+		}
+		w.sendFindingMessage(record, policy, name, inWindow)
+	}
+}
+
+func (w *PodWatcher) sendFindingMessage(record PodRecord, policy Policy, detector string, findings []Finding) {
+	detectorConfig := w.config.Detectors[detector]
+	last := findings[len(findings)-1]
+	msg := notify.GetFindingMessage(notify.FindingDetail{
+		Detector:       detector,
+		Severity:       detectorConfig.Severity,
+		Workload:       record.Workload(),
+		Namespace:      record.Namespace,
+		Pod:            last.PodName,
+		Container:      last.Container,
+		Detail:         last.Detail,
+		Count:          len(findings),
+		Threshold:      detectorConfig.Threshold,
+		TimeWindow:     record.TimeWindow,
+		PendingTimeout: w.config.PendingTimeout,
+		Events:         eventDetails(record.Events),
+	}, detectorConfig.Template)
+	w.sendNotification(policy.NotifyChannel, msg)
+}
+
+func (w *PodWatcher) sendRestartMessage(record PodRecord, policy Policy, reason string, logTail *LogTail) {
+	// Argo Rollout 附带当前发布阶段，便于判断是否发生在金丝雀或蓝绿发布中
+	if record.WorkloadKind == "Rollout" {
+		if rollout, err := getArgoRollout(w.dynamic, record.Namespace, record.WorkloadName); err == nil {
+			reason = fmt.Sprintf("%s; rollout %s", reason, argoRolloutPhase(rollout))
+		}
 	}
-	w.sendRollbackMessage(pod, message)
+	msg := notify.GetRestartMessage(restartDetail(record, policy, reason))
+	w.sendNotification(policy.NotifyChannel, w.appendLogTail(policy.NotifyChannel, msg, logTail))
+}
+func (w *PodWatcher) sendFirestRestartMessage(pod *v1.Pod, record PodRecord, policy Policy) {
+	msg := notify.GetFirstRestartMessage(pod, record.Workload(), policy.Threshold)
+	w.sendNotification(policy.NotifyChannel, msg)
+}
+func (w *PodWatcher) sendRollbackMessage(pod *v1.Pod, record PodRecord, message, diff string, policy Policy, logTail *LogTail) {
+	msg := notify.GetRollbackMessage(notify.RollbackDetail{
+		Workload:  record.Workload(),
+		Namespace: pod.Namespace,
+		PodName:   pod.Name,
+		Cause:     record.ProbableCause.String(),
+		Events:    eventDetails(record.Events),
+		Message:   message,
+		Diff:      diff,
+	})
+	w.sendNotification(policy.NotifyChannel, w.appendLogTail(policy.NotifyChannel, msg, logTail))
 }
 
-func (w *PodWatcher) notify(pod *v1.Pod, podUID string, now time.Time) {
-	w.resetRecord(podUID, now, pod)
-	w.sendRestartMessage(pod)
+// 按通知渠道的消息大小限制追加日志片段
+func (w *PodWatcher) appendLogTail(channel string, msg string, logTail *LogTail) string {
+	if logTail == nil {
+		return msg
+	}
+	notifyType, _ := w.notifyTarget(channel)
+	return notify.AppendLogTail(msg, logTail.String(), logTail.Content, notify.MessageLimit(notifyType))
 }
 
-func (w *PodWatcher) sendRestartMessage(pod *v1.Pod) {
-	msg := notify.GetRestartMessage(w.config, pod)
-	w.sendNotification(msg)
+func restartDetail(record PodRecord, policy Policy, reason string) notify.RestartDetail {
+	return notify.RestartDetail{
+		Workload:     record.Workload(),
+		Namespace:    record.Namespace,
+		PodName:      record.PodName,
+		Restarts:     record.RestartCount,
+		Threshold:    policy.Threshold,
+		CrashLooping: record.crashLoopingReplicas(),
+		Replicas:     record.Replicas,
+		Reason:       reason,
+		Containers:   containerDetails(record),
+		Events:       eventDetails(record.Events),
+		Cause:        record.ProbableCause.String(),
+	}
 }
-func (w *PodWatcher) sendFirestRestartMessage(pod *v1.Pod) {
-	msg := notify.GetFirstRestartMessage(w.config, pod)
-	w.sendNotification(msg)
+
+func eventDetails(events []EventSummary) []notify.EventDetail {
+	result := make([]notify.EventDetail, 0, len(events))
+	for _, event := range events {
+		result = append(result, notify.EventDetail{
+			PodName: event.PodName,
+			Type:    event.Type,
+			Reason:  event.Reason,
+			Message: event.Message,
+			Count:   event.Count,
+			Time:    event.Time,
+		})
+	}
+	return result
 }
-func (w *PodWatcher) sendRollbackMessage(pod *v1.Pod, message string) {
-	msg := notify.GetRollbackMessage(pod, message)
-	w.sendNotification(msg)
+
+// 按窗口内重启次数降序列出发生过重启的容器
+func containerDetails(record PodRecord) []notify.ContainerDetail {
+	var result []notify.ContainerDetail
+	for _, c := range record.Containers {
+		if c.RestartCount == 0 {
+			continue
+		}
+		result = append(result, notify.ContainerDetail{
+			Name:         c.Name,
+			Image:        c.Image,
+			Type:         c.Type,
+			Restarts:     c.RestartCount,
+			LastExitCode: c.LastExitCode,
+			LastReason:   c.LastReason,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Restarts != result[j].Restarts {
+			return result[i].Restarts > result[j].Restarts
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
 }
 
-func (w *PodWatcher) sendNotification(msg string) {
-	switch w.config.NotifyType {
+// 发送通知，channel为空时使用默认渠道
+func (w *PodWatcher) sendNotification(channel string, msg string) {
+	notifyType, webhook := w.notifyTarget(channel)
+	switch notifyType {
 	case "wechat":
-		notify.SendWechatWebhook(w.config, msg)
+		notify.SendWechatWebhook(webhook, msg)
 	case "lark":
-		notify.SendLarkWebhook(w.config, msg)
+		notify.SendLarkWebhook(webhook, msg)
 	default:
-		logrus.Warnf("Unsupported notification type: %s", w.config.NotifyType)
+		logrus.Warnf("Unsupported notification type: %s", notifyType)
 	}
 }
 
-func (w *PodWatcher) getRecord(podUID string) PodRecord {
+// 返回通知渠道的类型与webhook，channel为空或不存在时使用默认渠道
+func (w *PodWatcher) notifyTarget(channel string) (string, string) {
+	if c, exists := w.config.NotifyChannels[channel]; exists {
+		return c.Type, c.Webhook
+	}
+	return w.config.NotifyType, w.config.Webhook
+}
+
+// 返回记录的副本，Pods也会被复制，避免在锁外并发读写
+func (w *PodWatcher) getRecord(key string) PodRecord {
 	w.recordsMu.RLock()
 	defer w.recordsMu.RUnlock()
-	return w.records[podUID]
+	record := w.records[key]
+	pods := make(map[string]PodState, len(record.Pods))
+	for uid, state := range record.Pods {
+		pods[uid] = state
+	}
+	record.Pods = pods
+	containers := make(map[string]ContainerRecord, len(record.Containers))
+	for name, container := range record.Containers {
+		containers[name] = container
+	}
+	record.Containers = containers
+	findings := make(map[string][]Finding, len(record.Findings))
+	for detector, list := range record.Findings {
+		findings[detector] = append([]Finding(nil), list...)
+	}
+	record.Findings = findings
+	record.Events = append([]EventSummary(nil), record.Events...)
+	record.Restarts = append([]RestartEvent(nil), record.Restarts...)
+	return record
 }
 
-func logNewRecord(pod *v1.Pod, podUID string, now time.Time) {
+func logNewRecord(pod *v1.Pod, key string, now time.Time) {
 	logrus.WithFields(logrus.Fields{
 		"podName":       pod.Name,
-		"podUID":        podUID,
+		"record":        key,
 		"namespace":     pod.Namespace,
 		"firstDetected": now.Format("2006-01-02 15:04:05"),
-	}).Info("New record created for restarting pod")
+	}).Info("New record created for restarting workload")
 }
 
 func isCrashLooping(pod *v1.Pod) bool {
-	for _, cs := range pod.Status.ContainerStatuses {
+	for _, cs := range podContainerStatuses(pod) {
 		if cs.State.Waiting != nil && cs.State.Waiting.Reason == "CrashLoopBackOff" {
 			return true
 		}
@@ -180,7 +762,7 @@ func isCrashLooping(pod *v1.Pod) bool {
 }
 
 func isRestartEvent(pod *v1.Pod) bool {
-	for _, cs := range pod.Status.ContainerStatuses {
+	for _, cs := range podContainerStatuses(pod) {
 		if cs.RestartCount > 0 {
 			return true
 		}
@@ -188,12 +770,3 @@ func isRestartEvent(pod *v1.Pod) bool {
 
 	return false
 }
-func getRealRestartCount(pod *v1.Pod) int {
-	maxRestarts := 0
-	for _, cs := range pod.Status.ContainerStatuses {
-		if int(cs.RestartCount) > maxRestarts {
-			maxRestarts = int(cs.RestartCount)
-		}
-	}
-	return maxRestarts
-}
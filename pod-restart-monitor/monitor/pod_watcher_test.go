@@ -0,0 +1,110 @@
+package monitor
+
+import (
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 基于fake clientset的PodWatcher，测试结束时停止后台任务
+func newTestWatcher(t *testing.T, cfg *config.Config, objects ...runtime.Object) (*PodWatcher, *fake.Clientset) {
+	t.Helper()
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	client := fake.NewClientset(objects...)
+	watcher := NewPodWatcher(client, nil, cfg)
+	t.Cleanup(watcher.Shutdown)
+	return watcher, client
+}
+
+func TestThresholdReached(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	crashLooping := func(revisions ...string) map[string]PodState {
+		pods := make(map[string]PodState)
+		for i, revision := range revisions {
+			pods[string(rune('a'+i))] = PodState{CrashLooping: true, Revision: revision, NodeName: "node-" + string(rune('a'+i))}
+		}
+		return pods
+	}
+
+	tests := []struct {
+		name   string
+		record PodRecord
+		policy Policy
+		want   string // 期望的原因片段，为空表示不触发
+	}{
+		{
+			name:   "restart threshold",
+			record: PodRecord{RestartCount: 3},
+			policy: Policy{Threshold: 3, TimeWindow: 10 * time.Minute},
+			want:   "3 restarts across 0 replicas within 10m0s",
+		},
+		{
+			name:   "below threshold",
+			record: PodRecord{RestartCount: 2, Pods: crashLooping("v1")},
+			policy: Policy{Threshold: 3, TimeWindow: 10 * time.Minute},
+		},
+		{
+			name:   "crashloop replicas",
+			record: PodRecord{RestartCount: 1, Replicas: 3, Pods: crashLooping("v1", "v1")},
+			policy: Policy{Threshold: 5, CrashLoopReplicas: 2, TimeWindow: 10 * time.Minute},
+			want:   "2 of 3 replicas in CrashLoopBackOff",
+		},
+		{
+			name:   "crashloop replicas triggered within window",
+			record: PodRecord{RestartCount: 1, Pods: crashLooping("v1", "v1"), LastTriggered: now.Add(-5 * time.Minute)},
+			policy: Policy{Threshold: 5, CrashLoopReplicas: 2, TimeWindow: 10 * time.Minute},
+		},
+		{
+			name:   "daemonset nodes on the same revision",
+			record: PodRecord{WorkloadKind: "DaemonSet", Pods: crashLooping("v2", "v2", "v1")},
+			policy: Policy{Threshold: 5, CrashLoopNodes: 2, TimeWindow: 10 * time.Minute},
+			want:   "2 nodes in CrashLoopBackOff on revision v2",
+		},
+		{
+			name:   "daemonset nodes on different revisions",
+			record: PodRecord{WorkloadKind: "DaemonSet", Pods: crashLooping("v1", "v2")},
+			policy: Policy{Threshold: 5, CrashLoopNodes: 2, TimeWindow: 10 * time.Minute},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, reached := thresholdReached(tt.record, tt.policy, now)
+			if reached != (tt.want != "") {
+				t.Fatalf("reached = %v (%q), want %v", reached, reason, tt.want != "")
+			}
+			if !strings.Contains(reason, tt.want) {
+				t.Errorf("reason = %q, want %q", reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlePodDeleteClearsFindingsWithoutRecord(t *testing.T) {
+	watcher, _ := newTestWatcher(t, &config.Config{EventReasons: []string{"BackOff"}})
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default", UID: "uid-web-0"}}
+
+	watcher.activeFindings["uid-web-0"] = map[string]bool{"oom-killed/app": true}
+	watcher.events.Add(&v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web-0", UID: "uid-web-0"},
+		Reason:         "BackOff",
+		Count:          1,
+	})
+	if len(watcher.events.Recent("uid-web-0")) != 1 {
+		t.Fatal("event not indexed")
+	}
+
+	HandlePodDelete(watcher, pod)
+	if _, exists := watcher.activeFindings["uid-web-0"]; exists {
+		t.Error("active findings not cleared")
+	}
+	if events := watcher.events.Recent("uid-web-0"); len(events) != 0 {
+		t.Errorf("events not cleared: %+v", events)
+	}
+}
@@ -0,0 +1,212 @@
+package monitor
+
+import (
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 策略注解，可以标注在Pod、所属工作负载（Deployment/StatefulSet等）以及命名空间上
+// 优先级: Pod > 工作负载 > 命名空间 > 全局配置
+const (
+	AnnotationIgnore            = "podsentry.io/ignore"
+	AnnotationThreshold         = "podsentry.io/threshold"
+	AnnotationTimeWindow        = "podsentry.io/time-window"
+	AnnotationRollback          = "podsentry.io/rollback"
+	AnnotationNotifyChannel     = "podsentry.io/notify-channel"
+	AnnotationCrashLoopReplicas = "podsentry.io/crashloop-replicas"
+	AnnotationCrashLoopNodes    = "podsentry.io/crashloop-nodes"
+	AnnotationContainerInclude  = "podsentry.io/container-include"
+	AnnotationContainerExclude  = "podsentry.io/container-exclude"
+	AnnotationRollbackSkipCause = "podsentry.io/rollback-skip-causes"
+	AnnotationRemediation       = "podsentry.io/remediation"
+	AnnotationLadder            = "podsentry.io/ladder"
+	AnnotationCronJobSuspend    = "podsentry.io/cronjob-suspend-after"
+	AnnotationMinRevision       = "podsentry.io/rollback-min-revision"
+)
+
+// Policy 作用于单个Pod的最终策略
+type Policy struct {
+	Ignore            bool
+	Threshold         int // 时间窗口内所有副本的重启次数阈值
+	CrashLoopReplicas int // 同时处于CrashLoopBackOff的副本数阈值，0表示不启用
+	CrashLoopNodes    int // DaemonSet同一版本处于CrashLoopBackOff的节点数阈值，0表示不启用
+	TimeWindow        time.Duration
+	Rollback          string              // 回滚模式 off/on/dry-run
+	NotifyChannel     string              // 为空表示使用默认通知渠道
+	ContainerInclude  []string            // 只统计匹配的容器，为空表示全部
+	ContainerExclude  []string            // 不统计匹配的容器
+	RollbackSkipCause []string            // 可能原因命中这些分类或规则时不回滚
+	Remediation       string              // 达到阈值后的处置动作
+	Ladder            []config.LadderStep // 升级阶梯，非空时代替阈值判断
+	LadderGrace       time.Duration
+	LadderReset       time.Duration
+	CronJobSuspend    int   // CronJob连续失败多少次后暂停，0表示不暂停
+	MinRevision       int64 // 不回滚到版本号低于该值的版本，0表示不限制
+}
+
+// 解析Pod的最终策略，按 命名空间 -> 工作负载 -> Pod 的顺序逐层覆盖全局配置
+func (w *PodWatcher) resolvePolicy(pod *v1.Pod, workload *Workload) Policy {
+	policy := w.resolveWorkloadPolicy(pod.Namespace, workload)
+	w.applyPolicyAnnotations(&policy, pod.Annotations, "Pod/"+pod.Name, false)
+	return policy
+}
+
+// 不含Pod注解的策略，用于Job等没有具体Pod的事件
+func (w *PodWatcher) resolveWorkloadPolicy(namespace string, workload *Workload) Policy {
+	policy := Policy{
+		Threshold:         w.config.Threshold,
+		CrashLoopReplicas: w.config.CrashLoopReplicas,
+		CrashLoopNodes:    w.config.CrashLoopNodes,
+		TimeWindow:        w.config.TimeWindow,
+		Rollback:          w.config.Rollback,
+		ContainerInclude:  w.config.ContainerInclude,
+		ContainerExclude:  w.config.ContainerExclude,
+		RollbackSkipCause: w.config.RollbackSkipCauses,
+		Remediation:       w.config.Remediation,
+		Ladder:            w.config.Ladder,
+		LadderGrace:       w.config.LadderGrace,
+		LadderReset:       w.config.LadderReset,
+		CronJobSuspend:    w.config.CronJobSuspend,
+		MinRevision:       w.config.RollbackLimits.MinRevision,
+	}
+
+	ns, err := w.getNamespace(namespace)
+	if err != nil {
+		logrus.WithField("namespace", namespace).WithError(err).Warn("Failed to get namespace annotations")
+	} else {
+		w.applyPolicyAnnotations(&policy, ns.Annotations, "Namespace/"+ns.Name, true)
+	}
+
+	if workload != nil {
+		w.applyPolicyAnnotations(&policy, workload.Annotations, workload.String(), false)
+	}
+	return policy
+}
+
+// 是否走回滚流程，演练模式同样走完整的回滚决策
+func (p Policy) rollbackEnabled() bool {
+	return p.Rollback == config.RollbackModeOn || p.Rollback == config.RollbackModeDryRun || p.Rollback == config.RollbackModeApproval
+}
+
+func (p Policy) rollbackDryRun() bool {
+	return p.Rollback == config.RollbackModeDryRun
+}
+
+func (p Policy) rollbackApproval() bool {
+	return p.Rollback == config.RollbackModeApproval
+}
+
+var errNodeRemediation = fmt.Errorf("%s can only be set globally or by namespace annotation", config.RemediationCordonNode)
+
+// 用注解覆盖策略字段，非法值记录日志并忽略
+// 封锁节点会影响节点上的其他工作负载，只有全局配置与命名空间注解（allowNodeActions）可以选择，Pod与工作负载的注解不能选择
+func (w *PodWatcher) applyPolicyAnnotations(policy *Policy, annotations map[string]string, source string, allowNodeActions bool) {
+	for key, value := range annotations {
+		value = strings.TrimSpace(value)
+		var err error
+
+		switch key {
+		case AnnotationIgnore:
+			var ignore bool
+			if ignore, err = strconv.ParseBool(strings.ToLower(value)); err == nil {
+				policy.Ignore = ignore
+			}
+		case AnnotationThreshold:
+			var threshold int
+			if threshold, err = strconv.Atoi(value); err == nil && threshold > 0 {
+				policy.Threshold = threshold
+			}
+		case AnnotationTimeWindow:
+			var window time.Duration
+			if window, err = time.ParseDuration(value); err == nil && window > 0 {
+				policy.TimeWindow = window
+			}
+		case AnnotationRollback:
+			if mode, ok := config.ParseRollbackMode(value); ok {
+				policy.Rollback = mode
+			} else {
+				err = fmt.Errorf("invalid rollback mode %q", value)
+			}
+		case AnnotationCrashLoopReplicas:
+			var replicas int
+			if replicas, err = strconv.Atoi(value); err == nil && replicas >= 0 {
+				policy.CrashLoopReplicas = replicas
+			}
+		case AnnotationCrashLoopNodes:
+			var nodes int
+			if nodes, err = strconv.Atoi(value); err == nil && nodes >= 0 {
+				policy.CrashLoopNodes = nodes
+			}
+		case AnnotationContainerInclude:
+			policy.ContainerInclude = splitList(value)
+		case AnnotationContainerExclude:
+			policy.ContainerExclude = splitList(value)
+		case AnnotationRollbackSkipCause:
+			policy.RollbackSkipCause = splitList(value)
+		case AnnotationRemediation:
+			switch {
+			case !config.ValidRemediation(value):
+				err = fmt.Errorf("unknown remediation %q", value)
+			case value == config.RemediationCordonNode && !allowNodeActions:
+				err = errNodeRemediation
+			default:
+				policy.Remediation = value
+			}
+		case AnnotationCronJobSuspend:
+			var runs int
+			if runs, err = strconv.Atoi(value); err == nil && runs >= 0 {
+				policy.CronJobSuspend = runs
+			}
+		case AnnotationMinRevision:
+			var revision int64
+			if revision, err = strconv.ParseInt(value, 10, 64); err == nil && revision >= 0 {
+				policy.MinRevision = revision
+			}
+		case AnnotationLadder:
+			var ladder []config.LadderStep
+			if ladder, err = config.ParseLadder(value); err == nil {
+				for _, step := range ladder {
+					if step.Action == config.RemediationCordonNode && !allowNodeActions {
+						err = errNodeRemediation
+					}
+				}
+			}
+			if err == nil {
+				policy.Ladder = ladder
+			}
+		case AnnotationNotifyChannel:
+			if _, exists := w.config.NotifyChannels[value]; exists {
+				policy.NotifyChannel = value
+			} else {
+				logrus.WithFields(logrus.Fields{
+					"source":  source,
+					"channel": value,
+				}).Warn("Unknown notify channel in annotation, using default")
+			}
+		}
+
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"source":     source,
+				"annotation": key,
+				"value":      value,
+			}).WithError(err).Warn("Invalid policy annotation, ignored")
+		}
+	}
+}
+
+// 解析逗号分隔的注解值，忽略空项
+func splitList(input string) []string {
+	var result []string
+	for _, p := range strings.Split(input, ",") {
+		if trimmed := strings.TrimSpace(p); trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+	return result
+}
@@ -0,0 +1,262 @@
+package monitor
+
+import (
+	"context"
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"encoding/json"
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 处置动作写入工作负载与节点的注解
+const (
+	AnnotationNeedsAttention = "podsentry.io/needs-attention"
+	AnnotationScaledFrom     = "podsentry.io/scaled-from"
+	AnnotationCordonedFor    = "podsentry.io/cordoned-for"
+)
+
+// RemediationTarget 处置对象: 崩溃的Pod及其所属工作负载
+type RemediationTarget struct {
+	Pod       *v1.Pod
+	Kind      string
+	Name      string
+	Namespace string
+	Reason    string // 触发原因，写入注解供人工排查
+}
+
+func (t RemediationTarget) Workload() string {
+	return fmt.Sprintf("%s/%s", t.Kind, t.Name)
+}
+
+// Remediator 达到阈值后的处置动作，返回执行结果的描述
+type Remediator interface {
+	Name() string
+	Remediate(client kubernetes.Interface, target RemediationTarget, dryRun bool) (string, error)
+}
+
+func newRemediators(cfg *config.Config) map[string]Remediator {
+	remediators := make(map[string]Remediator)
+	for _, r := range []Remediator{
+		rolloutRestartRemediator{},
+		deletePodRemediator{},
+		pauseRemediator{},
+		scaleZeroRemediator{},
+		cordonNodeRemediator{maxNodes: cfg.RollbackLimits.MaxNodes},
+		annotateRemediator{},
+	} {
+		remediators[r.Name()] = r
+	}
+	return remediators
+}
+
+// 与 kubectl rollout restart 一致，修改Pod模板注解触发滚动重启
+type rolloutRestartRemediator struct{}
+
+func (rolloutRestartRemediator) Name() string { return config.RemediationRolloutRestart }
+
+func (rolloutRestartRemediator) Remediate(client kubernetes.Interface, target RemediationTarget, dryRun bool) (string, error) {
+	if !rollbackSupported(target.Kind) || target.Kind == "Rollout" {
+		return "", fmt.Errorf("rollout restart is only supported for Deployment, StatefulSet and DaemonSet, got %s", target.Kind)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{"kubectl.kubernetes.io/restartedAt": time.Now().Format(time.RFC3339)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := patchWorkload(client, target.Kind, target.Namespace, target.Name, types.StrategicMergePatchType, patch, dryRun); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s restarted", target.Workload()), nil
+}
+
+// 删除崩溃的Pod，由控制器重建；没有控制器的Pod删除后不会重建
+type deletePodRemediator struct{}
+
+func (deletePodRemediator) Name() string { return config.RemediationDeletePod }
+
+func (deletePodRemediator) Remediate(client kubernetes.Interface, target RemediationTarget, dryRun bool) (string, error) {
+	if metav1.GetControllerOf(target.Pod) == nil {
+		return "", fmt.Errorf("pod %s has no controller and would not be recreated", target.Pod.Name)
+	}
+	err := client.CoreV1().Pods(target.Pod.Namespace).Delete(context.TODO(), target.Pod.Name, metav1.DeleteOptions{DryRun: dryRunOption(dryRun)})
+	if err != nil {
+		return "", fmt.Errorf("failed to delete pod: %w", err)
+	}
+	return fmt.Sprintf("pod %s deleted", target.Pod.Name), nil
+}
+
+// 暂停Deployment，阻止继续滚动更新
+type pauseRemediator struct{}
+
+func (pauseRemediator) Name() string { return config.RemediationPause }
+
+func (pauseRemediator) Remediate(client kubernetes.Interface, target RemediationTarget, dryRun bool) (string, error) {
+	if target.Kind != "Deployment" {
+		return "", fmt.Errorf("pause is only supported for Deployment, got %s", target.Kind)
+	}
+	if err := patchWorkload(client, target.Kind, target.Namespace, target.Name, types.MergePatchType, []byte(`{"spec":{"paused":true}}`), dryRun); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s paused, resume with kubectl rollout resume", target.Workload()), nil
+}
+
+// 缩容到0，原副本数记录在注解中便于恢复
+type scaleZeroRemediator struct{}
+
+func (scaleZeroRemediator) Name() string { return config.RemediationScaleZero }
+
+func (scaleZeroRemediator) Remediate(client kubernetes.Interface, target RemediationTarget, dryRun bool) (string, error) {
+	var replicas *int32
+	switch target.Kind {
+	case "Deployment":
+		deploy, err := client.AppsV1().Deployments(target.Namespace).Get(context.TODO(), target.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to get deployment: %w", err)
+		}
+		replicas = deploy.Spec.Replicas
+	case "StatefulSet":
+		sts, err := client.AppsV1().StatefulSets(target.Namespace).Get(context.TODO(), target.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to get statefulset: %w", err)
+		}
+		replicas = sts.Spec.Replicas
+	default:
+		return "", fmt.Errorf("scale to zero is only supported for Deployment and StatefulSet, got %s", target.Kind)
+	}
+	previous := int32(1)
+	if replicas != nil {
+		previous = *replicas
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{AnnotationScaledFrom: strconv.Itoa(int(previous))},
+		},
+		"spec": map[string]interface{}{"replicas": 0},
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := patchWorkload(client, target.Kind, target.Namespace, target.Name, types.MergePatchType, patch, dryRun); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s scaled from %d to 0 replicas", target.Workload(), previous), nil
+}
+
+// 封锁崩溃Pod所在的节点，适用于节点本身异常导致的崩溃
+// 由PodSentry封锁、仍未解除的节点数达到上限后不再封锁，避免应用问题逐个封锁节点导致集群无法调度
+type cordonNodeRemediator struct {
+	maxNodes int // 0表示不限制
+}
+
+func (cordonNodeRemediator) Name() string { return config.RemediationCordonNode }
+
+func (r cordonNodeRemediator) Remediate(client kubernetes.Interface, target RemediationTarget, dryRun bool) (string, error) {
+	node := target.Pod.Spec.NodeName
+	if node == "" {
+		return "", fmt.Errorf("pod %s is not scheduled to a node", target.Pod.Name)
+	}
+	nodes, err := client.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list nodes: %w", err)
+	}
+	var cordoned []string
+	for _, n := range nodes.Items {
+		if n.Name == node && n.Spec.Unschedulable {
+			return fmt.Sprintf("node %s is already cordoned", node), nil
+		}
+		if n.Spec.Unschedulable && n.Annotations[AnnotationCordonedFor] != "" {
+			cordoned = append(cordoned, n.Name)
+		}
+	}
+	if r.maxNodes > 0 && len(cordoned) >= r.maxNodes {
+		return "", fmt.Errorf("%d nodes cordoned by podsentry reached the limit %d, uncordon and remove annotation %s from %s first",
+			len(cordoned), r.maxNodes, AnnotationCordonedFor, strings.Join(cordoned, ", "))
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				AnnotationCordonedFor: fmt.Sprintf("%s %s/%s", time.Now().Format(time.RFC3339), target.Namespace, target.Workload()),
+			},
+		},
+		"spec": map[string]interface{}{"unschedulable": true},
+	})
+	if err != nil {
+		return "", err
+	}
+	_, err = client.CoreV1().Nodes().Patch(
+		context.TODO(),
+		node,
+		types.MergePatchType,
+		patch,
+		metav1.PatchOptions{DryRun: dryRunOption(dryRun)},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to cordon node %s: %w", node, err)
+	}
+	if r.maxNodes == 0 {
+		return fmt.Sprintf("node %s cordoned (%d cordoned by podsentry)", node, len(cordoned)+1), nil
+	}
+	return fmt.Sprintf("node %s cordoned (%d/%d)", node, len(cordoned)+1, r.maxNodes), nil
+}
+
+// 只在工作负载上标注需要人工处理
+type annotateRemediator struct{}
+
+func (annotateRemediator) Name() string { return config.RemediationAnnotate }
+
+func (annotateRemediator) Remediate(client kubernetes.Interface, target RemediationTarget, dryRun bool) (string, error) {
+	value := fmt.Sprintf("%s %s", time.Now().Format(time.RFC3339), target.Reason)
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{AnnotationNeedsAttention: value},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := patchWorkload(client, target.Kind, target.Namespace, target.Name, types.MergePatchType, patch, dryRun); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s annotated with %s", target.Workload(), AnnotationNeedsAttention), nil
+}
+
+// 按工作负载类型提交补丁
+func patchWorkload(client kubernetes.Interface, kind, namespace, name string, patchType types.PatchType, patch []byte, dryRun bool) error {
+	opts := metav1.PatchOptions{DryRun: dryRunOption(dryRun)}
+	var err error
+	switch kind {
+	case "Deployment":
+		_, err = client.AppsV1().Deployments(namespace).Patch(context.TODO(), name, patchType, patch, opts)
+	case "StatefulSet":
+		_, err = client.AppsV1().StatefulSets(namespace).Patch(context.TODO(), name, patchType, patch, opts)
+	case "DaemonSet":
+		_, err = client.AppsV1().DaemonSets(namespace).Patch(context.TODO(), name, patchType, patch, opts)
+	case "Job":
+		_, err = client.BatchV1().Jobs(namespace).Patch(context.TODO(), name, patchType, patch, opts)
+	case "CronJob":
+		_, err = client.BatchV1().CronJobs(namespace).Patch(context.TODO(), name, patchType, patch, opts)
+	case "Pod":
+		_, err = client.CoreV1().Pods(namespace).Patch(context.TODO(), name, patchType, patch, opts)
+	default:
+		return fmt.Errorf("%s is not supported", kind)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to patch %s/%s: %w", kind, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package monitor
+
+import (
+	"context"
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"strings"
+	"testing"
+)
+
+func cordonedNode(name string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{AnnotationCordonedFor: "default/Deployment/web"}},
+		Spec:       v1.NodeSpec{Unschedulable: true},
+	}
+}
+
+func TestCordonNodeLimit(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default"}, Spec: v1.PodSpec{NodeName: "node-c"}}
+	target := RemediationTarget{Pod: pod, Kind: "Deployment", Name: "web", Namespace: "default"}
+	nodes := func() *fake.Clientset {
+		return fake.NewClientset(cordonedNode("node-a"), cordonedNode("node-b"), &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-c"}})
+	}
+
+	if _, err := (cordonNodeRemediator{maxNodes: 2}).Remediate(nodes(), target, false); err == nil || !strings.Contains(err.Error(), "reached the limit 2") {
+		t.Fatalf("err = %v, want limit reached", err)
+	}
+
+	// 0表示不限制
+	client := nodes()
+	if _, err := (cordonNodeRemediator{}).Remediate(client, target, false); err != nil {
+		t.Fatal(err)
+	}
+	node, err := client.CoreV1().Nodes().Get(context.TODO(), "node-c", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !node.Spec.Unschedulable || node.Annotations[AnnotationCordonedFor] == "" {
+		t.Errorf("node-c not cordoned: %+v", node)
+	}
+}
+
+func TestRemediationForJobAndBarePod(t *testing.T) {
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "migrate", Namespace: "default"}}
+	jobPod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:            "migrate-abcde",
+		Namespace:       "default",
+		OwnerReferences: []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "Job", Name: "migrate", Controller: boolPtr(true)}},
+	}}
+	barePod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "debug", Namespace: "default"}}
+	watcher, client := newTestWatcher(t, nil, job, jobPod, barePod)
+
+	// Job与裸Pod同样可以读取回滚状态并标注
+	for _, record := range []PodRecord{
+		{Namespace: "default", WorkloadKind: "Job", WorkloadName: "migrate"},
+		{Namespace: "default", WorkloadKind: "Pod", WorkloadName: "debug"},
+	} {
+		if _, err := watcher.loadRollbackState(record); err != nil {
+			t.Fatalf("%s: %v", record.Workload(), err)
+		}
+		target := RemediationTarget{Kind: record.WorkloadKind, Name: record.WorkloadName, Namespace: "default", Reason: "crash"}
+		if _, err := (annotateRemediator{}).Remediate(client, target, false); err != nil {
+			t.Fatalf("%s: %v", record.Workload(), err)
+		}
+	}
+	updated, err := client.BatchV1().Jobs("default").Get(context.TODO(), "migrate", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Annotations[AnnotationNeedsAttention] == "" {
+		t.Errorf("job not annotated: %v", updated.Annotations)
+	}
+
+	if _, err := watcher.loadRollbackState(PodRecord{Namespace: "default", WorkloadKind: "ReplicaSet", WorkloadName: "orphan"}); err == nil {
+		t.Error("expected unsupported workload kind")
+	}
+
+	// 裸Pod删除后不会重建
+	if _, err := (deletePodRemediator{}).Remediate(client, RemediationTarget{Pod: barePod, Kind: "Pod"}, false); err == nil {
+		t.Error("expected bare pod deletion to be refused")
+	}
+	if _, err := (deletePodRemediator{}).Remediate(client, RemediationTarget{Pod: jobPod, Kind: "Job"}, false); err != nil {
+		t.Error(err)
+	}
+	if _, err := (rolloutRestartRemediator{}).Remediate(client, RemediationTarget{Kind: "Job", Name: "migrate", Namespace: "default"}, false); err == nil {
+		t.Error("expected rollout restart of a job to be refused")
+	}
+}
+
+func TestCordonNodeOnlyFromNamespacePolicy(t *testing.T) {
+	namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "infra", Annotations: map[string]string{AnnotationRemediation: config.RemediationCordonNode}}}
+	watcher, _ := newTestWatcher(t, &config.Config{Remediation: config.RemediationRollback}, namespace)
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default", Annotations: map[string]string{
+		AnnotationRemediation: config.RemediationCordonNode,
+		AnnotationLadder:      "notify@2,cordon-node@4",
+	}}}
+	policy := watcher.resolvePolicy(pod, &Workload{Kind: "Deployment", Name: "web", Namespace: "default"})
+	if policy.Remediation != config.RemediationRollback || policy.Ladder != nil {
+		t.Errorf("pod annotations selected cordon-node: remediation %s, ladder %v", policy.Remediation, policy.Ladder)
+	}
+
+	workload := &Workload{Kind: "Deployment", Name: "web", Namespace: "infra", Annotations: map[string]string{AnnotationRemediation: config.RemediationCordonNode}}
+	if policy := watcher.resolveWorkloadPolicy("infra", workload); policy.Remediation != config.RemediationCordonNode {
+		t.Errorf("remediation = %s, want cordon-node from the namespace", policy.Remediation)
+	}
+	workload.Annotations[AnnotationRemediation] = config.RemediationDeletePod
+	if policy := watcher.resolveWorkloadPolicy("infra", workload); policy.Remediation != config.RemediationDeletePod {
+		t.Errorf("remediation = %s, want delete-pod from the workload", policy.Remediation)
+	}
+}
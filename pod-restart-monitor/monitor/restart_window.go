@@ -0,0 +1,112 @@
+package monitor
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"sort"
+	"time"
+)
+
+// 单条记录最多保留的重启事件数量
+const maxRestartHistory = 256
+
+// RestartEvent 一次容器重启
+type RestartEvent struct {
+	Time      time.Time // 容器上次终止的时间
+	PodName   string
+	Container string
+}
+
+// 计算自上次观察以来新增的重启，每次重启对应一个事件
+// 时间取容器上次终止的FinishedAt，缺失时使用事件到达时间；
+// 两次事件之间跳变多次时，只有最后一次的终止时间可知，其余按同一时间计
+func newRestarts(pod *v1.Pod, previous map[string]int32, firstSeen bool, now time.Time, policy Policy) []RestartEvent {
+	var result []RestartEvent
+	for _, cs := range podContainerStatuses(pod) {
+		if !policy.watchesContainer(cs.Name) {
+			continue
+		}
+		delta := int(cs.RestartCount - previous[cs.Name])
+		if firstSeen {
+			// 首次看到的Pod只统计最近一次重启，历史重启时间未知
+			delta = 0
+			if cs.RestartCount > 0 {
+				delta = 1
+			}
+		}
+		if delta <= 0 {
+			continue
+		}
+
+		finishedAt := lastFinishedAt(cs.ContainerStatus, now)
+		for i := 0; i < delta; i++ {
+			result = append(result, RestartEvent{
+				Time:      finishedAt,
+				PodName:   pod.Name,
+				Container: cs.Name,
+			})
+		}
+	}
+	return result
+}
+
+func lastFinishedAt(cs v1.ContainerStatus, now time.Time) time.Time {
+	if terminated := cs.LastTerminationState.Terminated; terminated != nil {
+		return terminatedAt(terminated, now)
+	}
+	return now
+}
+
+func containerRestartCounts(pod *v1.Pod) map[string]int32 {
+	statuses := podContainerStatuses(pod)
+	counts := make(map[string]int32, len(statuses))
+	for _, cs := range statuses {
+		counts[cs.Name] = cs.RestartCount
+	}
+	return counts
+}
+
+// 加入新的重启事件并按滑动窗口裁剪，返回落在窗口内的新增重启数
+func (r *PodRecord) addRestarts(events []RestartEvent, now time.Time) int {
+	added := 0
+	for _, event := range events {
+		if now.Sub(event.Time) <= r.TimeWindow {
+			r.Restarts = append(r.Restarts, event)
+			added++
+		}
+	}
+	sort.SliceStable(r.Restarts, func(i, j int) bool {
+		return r.Restarts[i].Time.Before(r.Restarts[j].Time)
+	})
+	r.pruneRestarts(now)
+	return added
+}
+
+// 移除滑动窗口之外的重启，并同步统计字段
+func (r *PodRecord) pruneRestarts(now time.Time) {
+	start := 0
+	for start < len(r.Restarts) && now.Sub(r.Restarts[start].Time) > r.TimeWindow {
+		start++
+	}
+	if len(r.Restarts)-start > maxRestartHistory {
+		start = len(r.Restarts) - maxRestartHistory
+	}
+	r.Restarts = append([]RestartEvent(nil), r.Restarts[start:]...)
+
+	r.RestartCount = len(r.Restarts)
+	if r.RestartCount > 0 {
+		r.FirstDetected = r.Restarts[0].Time
+		r.LastRestart = r.Restarts[r.RestartCount-1].Time
+	}
+
+	// 重新统计每个容器在窗口内的重启次数
+	for name, container := range r.Containers {
+		container.RestartCount = 0
+		r.Containers[name] = container
+	}
+	for _, event := range r.Restarts {
+		if container, exists := r.Containers[event.Container]; exists {
+			container.RestartCount++
+			r.Containers[event.Container] = container
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package monitor
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"testing"
+	"time"
+)
+
+func crashedPod(name string, restarts map[string]int32, finishedAt time.Time) *v1.Pod {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID("uid-" + name)}}
+	for container, count := range restarts {
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, v1.ContainerStatus{
+			Name:         container,
+			RestartCount: count,
+			LastTerminationState: v1.ContainerState{
+				Terminated: &v1.ContainerStateTerminated{ExitCode: 1, FinishedAt: metav1.NewTime(finishedAt)},
+			},
+		})
+	}
+	return pod
+}
+
+func TestNewRestarts(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	finished := now.Add(-time.Minute)
+
+	tests := []struct {
+		name      string
+		restarts  map[string]int32
+		previous  map[string]int32
+		firstSeen bool
+		policy    Policy
+		want      int
+	}{
+		{name: "new restarts since last observation", restarts: map[string]int32{"app": 3}, previous: map[string]int32{"app": 1}, want: 2},
+		{name: "no change", restarts: map[string]int32{"app": 3}, previous: map[string]int32{"app": 3}, want: 0},
+		{name: "first seen counts only the last restart", restarts: map[string]int32{"app": 5}, firstSeen: true, want: 1},
+		{name: "first seen without restarts", restarts: map[string]int32{"app": 0}, firstSeen: true, want: 0},
+		{name: "excluded container", restarts: map[string]int32{"app": 2, "istio-proxy": 4}, policy: Policy{ContainerExclude: []string{"istio-*"}}, want: 2},
+		{name: "included container only", restarts: map[string]int32{"app": 2, "worker": 1}, policy: Policy{ContainerInclude: []string{"worker"}}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := newRestarts(crashedPod("web-0", tt.restarts, finished), tt.previous, tt.firstSeen, now, tt.policy)
+			if len(events) != tt.want {
+				t.Fatalf("got %d restarts, want %d", len(events), tt.want)
+			}
+			for _, event := range events {
+				if !event.Time.Equal(finished) || event.PodName != "web-0" {
+					t.Errorf("unexpected restart event %+v", event)
+				}
+			}
+		})
+	}
+}
+
+func TestNewRestartsWithoutFinishedAt(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	pod := crashedPod("web-0", map[string]int32{"app": 1}, time.Time{})
+	events := newRestarts(pod, nil, false, now, Policy{})
+	if len(events) != 1 || !events[0].Time.Equal(now) {
+		t.Fatalf("expected one restart at now, got %+v", events)
+	}
+}
+
+func TestAddAndPruneRestarts(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	record := PodRecord{
+		TimeWindow: 10 * time.Minute,
+		Containers: map[string]ContainerRecord{"app": {Name: "app"}, "sidecar": {Name: "sidecar"}},
+	}
+
+	added := record.addRestarts([]RestartEvent{
+		{Time: now.Add(-20 * time.Minute), Container: "app"}, // 窗口之外
+		{Time: now.Add(-2 * time.Minute), Container: "sidecar"},
+		{Time: now.Add(-5 * time.Minute), Container: "app"},
+	}, now)
+	if added != 2 {
+		t.Fatalf("added = %d, want 2", added)
+	}
+	if record.RestartCount != 2 {
+		t.Fatalf("RestartCount = %d, want 2", record.RestartCount)
+	}
+	if !record.FirstDetected.Equal(now.Add(-5*time.Minute)) || !record.LastRestart.Equal(now.Add(-2*time.Minute)) {
+		t.Errorf("FirstDetected/LastRestart = %s/%s, restarts not sorted", record.FirstDetected, record.LastRestart)
+	}
+
+	// 6分钟后第一次重启滑出窗口
+	record.pruneRestarts(now.Add(6 * time.Minute))
+	if record.RestartCount != 1 || record.Restarts[0].Container != "sidecar" {
+		t.Fatalf("after prune got %+v", record.Restarts)
+	}
+	if record.Containers["app"].RestartCount != 0 || record.Containers["sidecar"].RestartCount != 1 {
+		t.Errorf("container counts not recomputed: %+v", record.Containers)
+	}
+}
+
+func TestPruneRestartsCapsHistory(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	record := PodRecord{TimeWindow: time.Hour, Containers: map[string]ContainerRecord{}}
+	for i := 0; i < maxRestartHistory+10; i++ {
+		record.Restarts = append(record.Restarts, RestartEvent{Time: now.Add(-time.Duration(maxRestartHistory+10-i) * time.Second)})
+	}
+	record.pruneRestarts(now)
+	if record.RestartCount != maxRestartHistory {
+		t.Fatalf("RestartCount = %d, want %d", record.RestartCount, maxRestartHistory)
+	}
+	if !record.LastRestart.Equal(now.Add(-time.Second)) {
+		t.Errorf("newest restart dropped, LastRestart = %s", record.LastRestart)
+	}
+}
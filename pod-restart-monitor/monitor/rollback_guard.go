@@ -0,0 +1,202 @@
+package monitor
+
+import (
+	"context"
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"time"
+)
+
+// 回滚状态注解，保存在被回滚的工作负载上，PodSentry重启后仍然有效；删除该注解即可重置熔断
+const AnnotationRollbackState = "podsentry.io/rollback-state"
+
+// RollbackState 工作负载的回滚历史与熔断状态
+// 版本号在回滚后会被重新编号（Deployment等恢复的模板获得新的版本号），本轮回滚掉的版本按模板哈希等不变的标识记录
+type RollbackState struct {
+	History          []RollbackEntry `json:"history,omitempty"`
+	Scheme           string          `json:"scheme,omitempty"`         // 版本标识的类型，回滚方式变化时重新开始记录
+	RolledBackFrom   []string        `json:"rolledBackFrom,omitempty"` // 本轮回滚掉的版本标识，不再作为回滚目标
+	CircuitOpenUntil *time.Time      `json:"circuitOpenUntil,omitempty"`
+	CircuitReason    string          `json:"circuitReason,omitempty"`
+}
+
+// RollbackEntry 一次回滚或其他处置动作，处置动作与回滚共用次数限制、冷却与熔断
+type RollbackEntry struct {
+	Time   time.Time `json:"time"`
+	From   int64     `json:"from,omitempty"`
+	To     int64     `json:"to,omitempty"`
+	Action string    `json:"action,omitempty"` // 回滚以外的处置动作
+}
+
+// 丢弃统计周期之外的回滚，周期内没有回滚时开始新的一轮，已回滚掉的版本随之失效
+func (s *RollbackState) prune(now time.Time, limits config.RollbackLimits) {
+	kept := s.History[:0]
+	for _, entry := range s.History {
+		if now.Sub(entry.Time) <= limits.Period {
+			kept = append(kept, entry)
+		}
+	}
+	s.History = kept
+	if len(s.History) == 0 {
+		s.Scheme = ""
+		s.RolledBackFrom = nil
+	}
+	if s.CircuitOpenUntil != nil && !now.Before(*s.CircuitOpenUntil) {
+		s.CircuitOpenUntil = nil
+		s.CircuitReason = ""
+	}
+}
+
+// 检查是否允许回滚，返回不允许的原因，以及是否需要打开熔断
+func (s *RollbackState) check(now time.Time, limits config.RollbackLimits) (string, bool) {
+	if s.CircuitOpenUntil != nil {
+		return fmt.Sprintf("rollback circuit open until %s: %s",
+			s.CircuitOpenUntil.Format("2006-01-02 15:04:05"), s.CircuitReason), false
+	}
+	if len(s.History) == 0 {
+		return "", false
+	}
+	if last := s.History[len(s.History)-1]; limits.Cooldown > 0 && now.Sub(last.Time) < limits.Cooldown {
+		return fmt.Sprintf("last rollback %s ago is within cooldown %s",
+			now.Sub(last.Time).Round(time.Second), limits.Cooldown), false
+	}
+	if limits.MaxCount > 0 && len(s.History) >= limits.MaxCount {
+		return fmt.Sprintf("%d rollbacks within %s reached the limit %d",
+			len(s.History), limits.Period, limits.MaxCount), true
+	}
+	return "", false
+}
+
+// 记录一次成功的回滚及回滚掉的版本，版本标识的类型变化时不同类型的标识不可比较，重新开始记录
+func (s *RollbackState) record(now time.Time, result *RollbackResult) {
+	if result.Scheme != s.Scheme {
+		s.Scheme = result.Scheme
+		s.RolledBackFrom = nil
+	}
+	if result.FromVersion != "" {
+		s.RolledBackFrom = append(s.RolledBackFrom, result.FromVersion)
+	}
+	s.History = append(s.History, RollbackEntry{Time: now, From: result.FromRevision, To: result.ToRevision})
+}
+
+// 记录一次回滚以外的处置动作
+func (s *RollbackState) recordAction(now time.Time, action string) {
+	s.History = append(s.History, RollbackEntry{Time: now, Action: action})
+}
+
+func (s *RollbackState) openCircuit(now time.Time, reason string, limits config.RollbackLimits) {
+	until := now.Add(limits.Period)
+	s.CircuitOpenUntil = &until
+	s.CircuitReason = reason
+}
+
+// 回滚选项，带上本轮已回滚掉的版本与策略中的最低版本
+func (s *RollbackState) options(dryRun bool, limits config.RollbackLimits, minRevision int64) RollbackOptions {
+	return RollbackOptions{DryRun: dryRun, Scheme: s.Scheme, RolledBackFrom: s.RolledBackFrom, MaxDepth: limits.MaxDepth, MinRevision: minRevision}
+}
+
+// 从工作负载注解读取回滚状态
+func (w *PodWatcher) loadRollbackState(record PodRecord) (*RollbackState, error) {
+	meta, err := w.workloadMeta(record)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &RollbackState{}
+	if value := meta.Annotations[AnnotationRollbackState]; value != "" {
+		if err := json.Unmarshal([]byte(value), state); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %w", AnnotationRollbackState, err)
+		}
+	}
+	return state, nil
+}
+
+var errUnsupportedWorkload = errors.New("workload kind is not supported")
+
+// 支持回滚的工作负载类型，其余类型只能执行处置动作
+func rollbackSupported(kind string) bool {
+	switch kind {
+	case "Deployment", "StatefulSet", "DaemonSet", "Rollout":
+		return true
+	}
+	return false
+}
+
+// 获取工作负载的元数据，回滚状态保存在其注解中
+func (w *PodWatcher) workloadMeta(record PodRecord) (*metav1.ObjectMeta, error) {
+	switch record.WorkloadKind {
+	case "Deployment":
+		deploy, err := w.client.AppsV1().Deployments(record.Namespace).Get(context.TODO(), record.WorkloadName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get deployment: %w", err)
+		}
+		return &deploy.ObjectMeta, nil
+	case "StatefulSet":
+		sts, err := w.client.AppsV1().StatefulSets(record.Namespace).Get(context.TODO(), record.WorkloadName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get statefulset: %w", err)
+		}
+		return &sts.ObjectMeta, nil
+	case "DaemonSet":
+		ds, err := w.client.AppsV1().DaemonSets(record.Namespace).Get(context.TODO(), record.WorkloadName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get daemonset: %w", err)
+		}
+		return &ds.ObjectMeta, nil
+	case "Rollout":
+		rollout, err := getArgoRollout(w.dynamic, record.Namespace, record.WorkloadName)
+		if err != nil {
+			return nil, err
+		}
+		return unstructuredMeta(rollout), nil
+	case "Job":
+		job, err := w.client.BatchV1().Jobs(record.Namespace).Get(context.TODO(), record.WorkloadName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get job: %w", err)
+		}
+		return &job.ObjectMeta, nil
+	case "CronJob":
+		cronJob, err := w.client.BatchV1().CronJobs(record.Namespace).Get(context.TODO(), record.WorkloadName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cronjob: %w", err)
+		}
+		return &cronJob.ObjectMeta, nil
+	case "Pod":
+		pod, err := w.client.CoreV1().Pods(record.Namespace).Get(context.TODO(), record.WorkloadName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pod: %w", err)
+		}
+		return &pod.ObjectMeta, nil
+	}
+	return nil, fmt.Errorf("%w: %s", errUnsupportedWorkload, record.WorkloadKind)
+}
+
+// 将回滚状态写回工作负载注解，只修改metadata，不会触发滚动更新
+func (w *PodWatcher) saveRollbackState(record PodRecord, state *RollbackState) error {
+	value, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{AnnotationRollbackState: string(value)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if record.WorkloadKind == "Rollout" {
+		_, err = w.dynamic.Resource(argoRolloutResource).Namespace(record.Namespace).Patch(context.TODO(), record.WorkloadName, types.MergePatchType, patch, metav1.PatchOptions{})
+	} else {
+		err = patchWorkload(w.client, record.WorkloadKind, record.Namespace, record.WorkloadName, types.MergePatchType, patch, false)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save rollback state: %w", err)
+	}
+	return nil
+}
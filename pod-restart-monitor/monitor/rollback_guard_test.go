@@ -0,0 +1,128 @@
+package monitor
+
+import (
+	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRollbackStateCheck(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	limits := config.RollbackLimits{MaxCount: 2, Period: 24 * time.Hour, Cooldown: 30 * time.Minute}
+	openUntil := now.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		state    RollbackState
+		want     string
+		openNext bool
+	}{
+		{name: "no history", state: RollbackState{}},
+		{name: "cooldown", state: RollbackState{History: []RollbackEntry{{Time: now.Add(-10 * time.Minute)}}}, want: "within cooldown"},
+		{name: "after cooldown", state: RollbackState{History: []RollbackEntry{{Time: now.Add(-time.Hour)}}}},
+		{
+			name:     "max count opens circuit",
+			state:    RollbackState{History: []RollbackEntry{{Time: now.Add(-3 * time.Hour)}, {Time: now.Add(-time.Hour), Action: config.RemediationDeletePod}}},
+			want:     "reached the limit 2",
+			openNext: true,
+		},
+		{name: "circuit open", state: RollbackState{CircuitOpenUntil: &openUntil, CircuitReason: "too many"}, want: "circuit open"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, open := tt.state.check(now, limits)
+			if (reason != "") != (tt.want != "") || !strings.Contains(reason, tt.want) {
+				t.Errorf("check = %q, want %q", reason, tt.want)
+			}
+			if open != tt.openNext {
+				t.Errorf("open circuit = %v, want %v", open, tt.openNext)
+			}
+		})
+	}
+}
+
+func TestRollbackStatePrune(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	limits := config.RollbackLimits{Period: 24 * time.Hour}
+	expired := now.Add(-time.Minute)
+
+	state := RollbackState{
+		History:          []RollbackEntry{{Time: now.Add(-25 * time.Hour)}, {Time: now.Add(-time.Hour)}},
+		Scheme:           schemeDeployment,
+		RolledBackFrom:   []string{"hash-3"},
+		CircuitOpenUntil: &expired,
+		CircuitReason:    "too many",
+	}
+	state.prune(now, limits)
+	if len(state.History) != 1 || state.CircuitOpenUntil != nil || state.CircuitReason != "" {
+		t.Fatalf("unexpected state after prune: %+v", state)
+	}
+	if !reflect.DeepEqual(state.RolledBackFrom, []string{"hash-3"}) {
+		t.Errorf("rolled back versions dropped while the round is active: %v", state.RolledBackFrom)
+	}
+
+	// 周期内没有回滚时开始新的一轮
+	state.prune(now.Add(24*time.Hour), limits)
+	if len(state.History) != 0 || state.Scheme != "" || state.RolledBackFrom != nil {
+		t.Errorf("round not reset: %+v", state)
+	}
+}
+
+func TestRollbackStateRecord(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	state := RollbackState{}
+
+	state.record(now, &RollbackResult{FromRevision: 5, ToRevision: 4, Scheme: schemeDeployment, FromVersion: "hash-5"})
+	state.record(now, &RollbackResult{FromRevision: 6, ToRevision: 3, Scheme: schemeDeployment, FromVersion: "hash-4"})
+	if state.Scheme != schemeDeployment || !reflect.DeepEqual(state.RolledBackFrom, []string{"hash-5", "hash-4"}) {
+		t.Fatalf("unexpected state %+v", state)
+	}
+
+	// 回滚方式变化后标识不可比较，重新记录
+	state.record(now, &RollbackResult{FromRevision: 9, ToRevision: 8, Scheme: schemeHelm, FromVersion: "9"})
+	if state.Scheme != schemeHelm || !reflect.DeepEqual(state.RolledBackFrom, []string{"9"}) {
+		t.Errorf("scheme change did not reset rolled back versions: %+v", state)
+	}
+	state.recordAction(now, config.RemediationDeletePod)
+	if len(state.History) != 4 || state.History[3].Action != config.RemediationDeletePod {
+		t.Errorf("action not recorded: %+v", state.History)
+	}
+}
+
+func TestRollbackOptionsCheckTarget(t *testing.T) {
+	state := RollbackState{Scheme: schemeDeployment, RolledBackFrom: []string{"hash-5"}}
+	opts := state.options(false, config.RollbackLimits{MaxDepth: 2}, 0)
+
+	if err := opts.checkTarget(schemeDeployment, "hash-5", 3); !errors.Is(err, errRollbackDepth) {
+		t.Errorf("rolling back to a rolled back version: err = %v", err)
+	}
+	if err := opts.checkTarget(schemeDeployment, "hash-3", 3); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	// 其他类型的标识不受本轮记录影响
+	if err := opts.checkTarget(schemeHelm, "hash-5", 3); err != nil {
+		t.Errorf("unexpected error for another scheme %v", err)
+	}
+
+	state.RolledBackFrom = append(state.RolledBackFrom, "hash-4")
+	opts = state.options(false, config.RollbackLimits{MaxDepth: 2}, 0)
+	if err := opts.checkTarget(schemeDeployment, "hash-3", 3); !errors.Is(err, errRollbackDepth) {
+		t.Errorf("max depth not enforced: err = %v", err)
+	}
+	opts = state.options(false, config.RollbackLimits{}, 0)
+	if err := opts.checkTarget(schemeDeployment, "hash-3", 3); err != nil {
+		t.Errorf("unlimited depth refused: %v", err)
+	}
+
+	// 最低版本与回滚轮次无关
+	opts = (&RollbackState{}).options(false, config.RollbackLimits{}, 3)
+	if err := opts.checkTarget(schemeDeployment, "hash-2", 2); !errors.Is(err, errRollbackDepth) {
+		t.Errorf("min revision not enforced: err = %v", err)
+	}
+	if err := opts.checkTarget(schemeDeployment, "hash-3", 3); err != nil {
+		t.Errorf("min revision refused its own revision: %v", err)
+	}
+}
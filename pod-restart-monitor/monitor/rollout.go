@@ -0,0 +1,182 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"time"
+)
+
+// 回滚后轮询工作负载滚动状态的间隔
+const rolloutPollInterval = 10 * time.Second
+
+// RolloutStatus 工作负载的滚动状态
+type RolloutStatus struct {
+	Done     bool
+	Failed   string // 非空表示滚动已失败（如超过progressDeadlineSeconds）
+	Manual   string // 非空表示控制器不会自动替换Pod（OnDelete策略），需要人工删除Pod
+	Progress string
+}
+
+// 跟踪回滚后的滚动直到完成、失败或超时，并发送最终的验证结果
+func (w *PodWatcher) verifyRollout(pod *v1.Pod, record PodRecord, policy Policy, result *RollbackResult, started time.Time) {
+	ctx, cancel := context.WithTimeout(w.ctx, w.config.RolloutTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(rolloutPollInterval)
+	defer ticker.Stop()
+
+	fields := logrus.Fields{"workload": result.Workload(), "namespace": result.Namespace}
+	var status RolloutStatus
+	for {
+		select {
+		case <-ctx.Done():
+			if w.ctx.Err() != nil {
+				logrus.WithFields(fields).Info("Shutting down, rollout verification stopped")
+				return
+			}
+			message := fmt.Sprintf("Rollback NOT verified, manual intervention required: %s did not finish rolling out revision %d within %s (%s)",
+				result.Subject(), result.ToRevision, w.config.RolloutTimeout, status.Progress)
+			logrus.WithFields(fields).Warn("Rollout did not complete in time")
+			w.sendRollbackMessage(pod, record, message, "", policy, nil)
+			return
+		case <-ticker.C:
+		}
+
+		var err error
+		status, err = rolloutStatus(ctx, w.client, w.dynamic, result)
+		if err != nil {
+			logrus.WithFields(fields).WithError(err).Warn("Failed to get rollout status")
+			continue
+		}
+		logrus.WithFields(fields).WithField("progress", status.Progress).Info("Rollout progress")
+
+		duration := time.Since(started).Round(time.Second)
+		switch {
+		case status.Manual != "":
+			message := fmt.Sprintf("Rollback submitted, pods must be deleted: %s rolled back from revision %d to %d, but %s (%s)",
+				result.Subject(), result.FromRevision, result.ToRevision, status.Manual, status.Progress)
+			logrus.WithFields(fields).WithField("reason", status.Manual).Warn("Rollout requires manual pod deletion")
+			w.sendRollbackMessage(pod, record, message, "", policy, nil)
+			return
+		case status.Failed != "":
+			message := fmt.Sprintf("Rollback FAILED, manual intervention required: %s rollout to revision %d stalled after %s: %s (%s)",
+				result.Subject(), result.ToRevision, duration, status.Failed, status.Progress)
+			logrus.WithFields(fields).WithField("reason", status.Failed).Error("Rollout failed")
+			w.sendRollbackMessage(pod, record, message, "", policy, nil)
+			return
+		case status.Done:
+			message := fmt.Sprintf("Rollback verified: %s rolled back from revision %d to %d and completed in %s (%s)",
+				result.Subject(), result.FromRevision, result.ToRevision, duration, status.Progress)
+			logrus.WithFields(fields).WithField("duration", duration).Info("Rollout completed")
+			w.sendRollbackMessage(pod, record, message, "", policy, nil)
+			return
+		}
+	}
+}
+
+// 获取回滚的工作负载当前的滚动状态
+func rolloutStatus(ctx context.Context, client kubernetes.Interface, dynamicClient dynamic.Interface, result *RollbackResult) (RolloutStatus, error) {
+	if result.GitOps != nil {
+		status, synced, err := argoSyncStatus(ctx, dynamicClient, result)
+		if err != nil || !synced {
+			return status, err
+		}
+	}
+	switch result.Kind {
+	case "Deployment":
+		deploy, err := client.AppsV1().Deployments(result.Namespace).Get(ctx, result.Name, metav1.GetOptions{})
+		if err != nil {
+			return RolloutStatus{}, err
+		}
+		return deploymentRolloutStatus(deploy, result.Generation), nil
+	case "StatefulSet":
+		sts, err := client.AppsV1().StatefulSets(result.Namespace).Get(ctx, result.Name, metav1.GetOptions{})
+		if err != nil {
+			return RolloutStatus{}, err
+		}
+		return statefulSetRolloutStatus(sts, result.Generation), nil
+	case "DaemonSet":
+		ds, err := client.AppsV1().DaemonSets(result.Namespace).Get(ctx, result.Name, metav1.GetOptions{})
+		if err != nil {
+			return RolloutStatus{}, err
+		}
+		return daemonSetRolloutStatus(ds, result.Generation), nil
+	case "Rollout":
+		rollout, err := getArgoRollout(dynamicClient, result.Namespace, result.Name)
+		if err != nil {
+			return RolloutStatus{}, err
+		}
+		return argoRolloutStatus(rollout, result.Generation), nil
+	}
+	return RolloutStatus{}, fmt.Errorf("unsupported workload kind %s", result.Kind)
+}
+
+// 与 kubectl rollout status 的判断一致
+func deploymentRolloutStatus(deploy *appsv1.Deployment, generation int64) RolloutStatus {
+	replicas := int32(1)
+	if deploy.Spec.Replicas != nil {
+		replicas = *deploy.Spec.Replicas
+	}
+	status := deploy.Status
+	progress := fmt.Sprintf("updated %d/%d, available %d, total %d",
+		status.UpdatedReplicas, replicas, status.AvailableReplicas, status.Replicas)
+
+	if status.ObservedGeneration < generation || status.ObservedGeneration < deploy.Generation {
+		return RolloutStatus{Progress: "waiting for controller to observe the rollback"}
+	}
+	for _, cond := range status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			return RolloutStatus{Failed: cond.Message, Progress: progress}
+		}
+	}
+	done := status.UpdatedReplicas == replicas &&
+		status.Replicas == status.UpdatedReplicas &&
+		status.AvailableReplicas == status.UpdatedReplicas
+	return RolloutStatus{Done: done, Progress: progress}
+}
+
+func statefulSetRolloutStatus(sts *appsv1.StatefulSet, generation int64) RolloutStatus {
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	status := sts.Status
+	progress := fmt.Sprintf("updated %d/%d, ready %d", status.UpdatedReplicas, replicas, status.ReadyReplicas)
+
+	if status.ObservedGeneration < generation || status.ObservedGeneration < sts.Generation {
+		return RolloutStatus{Progress: "waiting for controller to observe the rollback"}
+	}
+	if sts.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType && status.UpdateRevision != status.CurrentRevision {
+		return RolloutStatus{Manual: "update strategy is OnDelete, the controller does not replace existing pods", Progress: progress}
+	}
+	if status.ReadyReplicas < replicas {
+		return RolloutStatus{Progress: progress}
+	}
+	// 分区滚动更新只要求分区内的副本完成更新
+	if partition := int32(statefulSetPartition(sts)); partition > 0 {
+		return RolloutStatus{Done: status.UpdatedReplicas >= replicas-partition, Progress: progress}
+	}
+	return RolloutStatus{Done: status.UpdateRevision == status.CurrentRevision, Progress: progress}
+}
+
+func daemonSetRolloutStatus(ds *appsv1.DaemonSet, generation int64) RolloutStatus {
+	status := ds.Status
+	progress := fmt.Sprintf("updated %d/%d nodes, available %d",
+		status.UpdatedNumberScheduled, status.DesiredNumberScheduled, status.NumberAvailable)
+
+	if status.ObservedGeneration < generation || status.ObservedGeneration < ds.Generation {
+		return RolloutStatus{Progress: "waiting for controller to observe the rollback"}
+	}
+	if ds.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType && status.UpdatedNumberScheduled < status.DesiredNumberScheduled {
+		return RolloutStatus{Manual: "update strategy is OnDelete, the controller does not replace existing pods", Progress: progress}
+	}
+	done := status.UpdatedNumberScheduled == status.DesiredNumberScheduled &&
+		status.NumberAvailable == status.DesiredNumberScheduled
+	return RolloutStatus{Done: done, Progress: progress}
+}
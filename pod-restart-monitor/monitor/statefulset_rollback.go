@@ -0,0 +1,134 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"strconv"
+	"strings"
+)
+
+// 回滚StatefulSet到上一个ControllerRevision
+func rollbackStatefulSet(name string, pod *v1.Pod, client kubernetes.Interface, opts RollbackOptions) (*RollbackResult, error) {
+	sts, err := client.AppsV1().StatefulSets(pod.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get statefulset: %w", err)
+	}
+
+	revisions, err := getOwnedControllerRevisions(client, sts.Namespace, sts.Spec.Selector, sts.UID)
+	if err != nil {
+		return nil, err
+	}
+	current, target, err := findPreviousControllerRevision(revisions, sts.Status.UpdateRevision, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// 崩溃的Pod不是更新版本（如位于分区之下），回滚模板对其无效
+	if podRevision := pod.Labels[appsv1.ControllerRevisionHashLabelKey]; podRevision != "" && podRevision != current.Name {
+		return nil, fmt.Errorf("pod %s runs revision %s, not the update revision %s", pod.Name, podRevision, current.Name)
+	}
+
+	// ControllerRevision.Data 是对 spec.template 的策略合并补丁，与 kubectl rollout undo 一致
+	if err := opts.checkTarget(schemeControllerRevision, target.Name, target.Revision); err != nil {
+		return nil, err
+	}
+
+	// 补丁携带resourceVersion，期间StatefulSet被修改时返回冲突，重试时重新读取
+	var patched *appsv1.StatefulSet
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest, err := client.AppsV1().StatefulSets(sts.Namespace).Get(context.TODO(), sts.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		// 期间有新的发布时放弃回滚，避免覆盖他人的变更
+		if latest.Generation != sts.Generation {
+			return fmt.Errorf("statefulset generation changed from %d to %d during rollback", sts.Generation, latest.Generation)
+		}
+		patch, err := withRollbackAnnotations(target.Data.Raw, latest.ResourceVersion, current.Revision, target.Revision)
+		if err != nil {
+			return err
+		}
+		patched, err = client.AppsV1().StatefulSets(sts.Namespace).Patch(
+			context.TODO(),
+			sts.Name,
+			types.StrategicMergePatchType,
+			patch,
+			metav1.PatchOptions{DryRun: dryRunOption(opts.DryRun)},
+		)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to patch statefulset: %w", err)
+	}
+	result := &RollbackResult{
+		Kind:         "StatefulSet",
+		Name:         sts.Name,
+		Namespace:    sts.Namespace,
+		FromRevision: current.Revision,
+		ToRevision:   target.Revision,
+		DryRun:       opts.DryRun,
+		Generation:   patched.Generation,
+		Diff:         templateDiff(sts.Spec.Template, patched.Spec.Template),
+		Scheme:       schemeControllerRevision,
+		FromVersion:  current.Name,
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"statefulset":  sts.Name,
+		"namespace":    sts.Namespace,
+		"fromRevision": current.Revision,
+		"toRevision":   target.Revision,
+		"partition":    statefulSetPartition(sts),
+		"dryRun":       opts.DryRun,
+	}).Info("StatefulSet template restored")
+
+	if !statefulSetNeedsPodDeletion(sts, pod) {
+		return result, nil
+	}
+	// OnDelete策略不会自动替换Pod；滚动更新时崩溃的Pod会阻塞更新，需要删除后按恢复的模板重建
+	if err := client.CoreV1().Pods(pod.Namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{DryRun: dryRunOption(opts.DryRun)}); err != nil {
+		return nil, fmt.Errorf("template restored but failed to delete crashing pod %s: %w", pod.Name, err)
+	}
+	logrus.WithFields(logrus.Fields{
+		"statefulset": sts.Name,
+		"pod":         pod.Name,
+		"dryRun":      opts.DryRun,
+	}).Info("Crashing StatefulSet pod deleted to apply restored revision")
+	return result, nil
+}
+
+// 是否需要删除崩溃的Pod: OnDelete策略始终需要；滚动更新时只处理分区内（序号>=partition）的Pod
+func statefulSetNeedsPodDeletion(sts *appsv1.StatefulSet, pod *v1.Pod) bool {
+	if sts.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return true
+	}
+	ordinal, ok := podOrdinal(pod)
+	return ok && ordinal >= statefulSetPartition(sts)
+}
+
+func statefulSetPartition(sts *appsv1.StatefulSet) int {
+	if ru := sts.Spec.UpdateStrategy.RollingUpdate; ru != nil && ru.Partition != nil {
+		return int(*ru.Partition)
+	}
+	return 0
+}
+
+// Pod序号，优先取 apps.kubernetes.io/pod-index 标签，其次取名称后缀
+func podOrdinal(pod *v1.Pod) (int, bool) {
+	value := pod.Labels[appsv1.PodIndexLabel]
+	if value == "" {
+		value = pod.Name[strings.LastIndex(pod.Name, "-")+1:]
+	}
+	ordinal, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+	return ordinal, true
+}
@@ -0,0 +1,124 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ApprovalDetail 处置动作审批的内容
+type ApprovalDetail struct {
+	ID            string
+	Action        string // 待审批的处置动作，如rollback
+	Workload      string
+	Namespace     string
+	PodName       string
+	Reason        string
+	Cause         string
+	Deadline      time.Time
+	DefaultAction string
+	Links         map[string]string // 企业微信审批链接，键为审批动作
+}
+
+// 审批动作与按钮文字，按展示顺序
+var approvalActions = []struct {
+	Action string
+	Text   string
+	Type   string
+}{
+	{"approve", "Approve", "primary"},
+	{"reject", "Reject", "danger"},
+	{"snooze", "Snooze", "default"},
+}
+
+func approvalText(detail ApprovalDetail) string {
+	return fmt.Sprintf(`
+		WORKLOAD: %s
+		POD: %s
+		NAMESPACE: %s
+		REASON: %s
+		PROBABLE_CAUSE: %s
+		DEADLINE: %s (then %s)
+		TIMESTAMP: %s
+		MESSAGE:  %s
+		`,
+		detail.Workload,
+		detail.PodName,
+		detail.Namespace,
+		detail.Reason,
+		detail.Cause,
+		detail.Deadline.Format("2006-01-02 15:04:05"),
+		detail.DefaultAction,
+		time.Now().Format("2006-01-02 15:04:05"),
+		detail.Action+" requires approval")
+}
+
+// GetApprovalMessage 带审批链接的文本消息，用于不支持卡片回调的企业微信
+func GetApprovalMessage(detail ApprovalDetail) string {
+	lines := make([]string, 0, len(approvalActions))
+	for _, a := range approvalActions {
+		if link, exists := detail.Links[a.Action]; exists {
+			lines = append(lines, fmt.Sprintf("%s: %s", strings.ToUpper(a.Action), link))
+		}
+	}
+	return approvalText(detail) + strings.Join(lines, "\n\t\t")
+}
+
+// GetLarkApprovalCard 飞书交互卡片，按钮点击后回调审批服务
+func GetLarkApprovalCard(detail ApprovalDetail) map[string]interface{} {
+	actions := make([]map[string]interface{}, 0, len(approvalActions))
+	for _, a := range approvalActions {
+		actions = append(actions, map[string]interface{}{
+			"tag":  "button",
+			"text": map[string]string{"tag": "plain_text", "content": a.Text},
+			"type": a.Type,
+			"value": map[string]string{
+				"approval_id": detail.ID,
+				"action":      a.Action,
+			},
+		})
+	}
+
+	return map[string]interface{}{
+		"config": map[string]bool{"wide_screen_mode": true},
+		"header": map[string]interface{}{
+			"title":    map[string]string{"tag": "plain_text", "content": fmt.Sprintf("Approval: %s %s", detail.Action, detail.Workload)},
+			"template": "orange",
+		},
+		"elements": []interface{}{
+			map[string]interface{}{
+				"tag":  "div",
+				"text": map[string]string{"tag": "plain_text", "content": TruncateMessage(approvalText(detail), MessageLimit("lark"))},
+			},
+			map[string]interface{}{
+				"tag":     "action",
+				"actions": actions,
+			},
+		},
+	}
+}
+
+// 飞书交互卡片通知
+func SendLarkCard(webhook string, card map[string]interface{}) {
+	payload := map[string]interface{}{
+		"msg_type": "interactive",
+		"card":     card,
+	}
+
+	sendHTTPRequest(webhook, payload)
+}
+
+// GetApprovalResultMessage 审批处理结果
+func GetApprovalResultMessage(detail ApprovalDetail, action, operator string) string {
+	return fmt.Sprintf(`
+		WORKLOAD: %s
+		NAMESPACE: %s
+		APPROVAL: %s by %s
+		TIMESTAMP: %s
+		`,
+		detail.Workload,
+		detail.Namespace,
+		action,
+		operator,
+		time.Now().Format("2006-01-02 15:04:05"))
+}
@@ -0,0 +1,42 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+)
+
+// JobDetail Job失败通知的内容
+type JobDetail struct {
+	Workload       string // Job/名称 或 CronJob/名称
+	Job            string // 失败的Job
+	Namespace      string
+	Reason         string // Job失败条件的原因，如BackoffLimitExceeded
+	History        string // 运行历史摘要
+	LastSuccessful *time.Time
+	Message        string
+}
+
+func GetJobMessage(detail JobDetail) string {
+	lastSuccessful := "never"
+	if detail.LastSuccessful != nil {
+		lastSuccessful = detail.LastSuccessful.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprintf(`
+		WORKLOAD: %s
+		JOB: %s
+		NAMESPACE: %s
+		REASON: %s
+		HISTORY: %s
+		LAST_SUCCESS: %s
+		TIMESTAMP: %s
+		MESSAGE: %s
+		`,
+		detail.Workload,
+		detail.Job,
+		detail.Namespace,
+		detail.Reason,
+		detail.History,
+		lastSuccessful,
+		time.Now().Format("2006-01-02 15:04:05"),
+		detail.Message)
+}
@@ -2,37 +2,100 @@ package notify
 
 import (
 	"bytes"
-	"e.coding.byd.com/dpc/dpcyunwei/PodSentry/pod-restart-monitor/config"
 	"encoding/json"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	"net/http"
+	"strings"
+	"text/template"
 	"time"
+	"unicode/utf8"
 )
 
 // 企业微信webhook通知
-func SendWechatWebhook(cfg *config.Config, message string) {
+func SendWechatWebhook(webhook string, message string) {
 	payload := map[string]interface{}{
 		"msgtype": "text",
 		"text": map[string]string{
-			"content": message,
+			"content": TruncateMessage(message, MessageLimit("wechat")),
 		},
 	}
 
-	sendHTTPRequest(cfg.Webhook, payload)
+	sendHTTPRequest(webhook, payload)
 }
 
 // 飞书webhook通知
-func SendLarkWebhook(cfg *config.Config, message string) {
+func SendLarkWebhook(webhook string, message string) {
 	payload := map[string]interface{}{
 		"msg_type": "text",
 		"content": map[string]string{
-			"text": message,
+			"text": TruncateMessage(message, MessageLimit("lark")),
 		},
 	}
 
-	sendHTTPRequest(cfg.Webhook, payload)
+	sendHTTPRequest(webhook, payload)
+}
+
+// MessageLimit 各通知渠道单条消息的最大字节数
+func MessageLimit(notifyType string) int {
+	switch notifyType {
+	case "wechat":
+		return 2048 // 企业微信文本消息上限
+	case "lark":
+		return 20000 // 飞书自定义机器人请求体上限为20KB，预留JSON开销
+	default:
+		return 4096
+	}
+}
+
+// TruncateMessage 按字节截断消息，不截断UTF-8字符
+func TruncateMessage(message string, limit int) string {
+	if len(message) <= limit {
+		return message
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(message[cut]) {
+		cut--
+	}
+	return message[:cut]
+}
+
+// AppendLogTail 在消息末尾追加日志片段，总长度超出limit时从最早的行开始丢弃
+func AppendLogTail(message string, source string, logs string, limit int) string {
+	if logs == "" {
+		return message
+	}
+	header := fmt.Sprintf("\n\t\tLOG_TAIL (%s, previous):\n", source)
+	budget := limit - len(message) - len(header)
+	if budget <= 0 {
+		return message
+	}
+
+	lines := strings.Split(logs, "\n")
+	kept := 0
+	size := 0
+	for i := len(lines) - 1; i >= 0; i-- {
+		if size+len(lines[i])+1 > budget {
+			break
+		}
+		size += len(lines[i]) + 1
+		kept++
+	}
+
+	var snippet string
+	if kept == 0 {
+		// 最后一行本身超长，保留其末尾部分
+		last := lines[len(lines)-1]
+		start := len(last) - budget
+		for start < len(last) && !utf8.RuneStart(last[start]) {
+			start++
+		}
+		snippet = last[start:]
+	} else {
+		snippet = strings.Join(lines[len(lines)-kept:], "\n")
+	}
+	return message + header + snippet
 }
 
 // 通用HTTP请求发送函数
@@ -63,43 +126,200 @@ func sendHTTPRequest(url string, payload interface{}) {
 	}
 }
 
+// RestartDetail 工作负载重启告警的内容
+type RestartDetail struct {
+	Workload     string
+	Namespace    string
+	PodName      string // 最近一次重启的Pod
+	Restarts     int
+	Threshold    int
+	CrashLooping int // 处于CrashLoopBackOff的副本数
+	Replicas     int32
+	Reason       string
+	Containers   []ContainerDetail
+	Events       []EventDetail
+	Cause        string // 可能原因
+}
+
+// EventDetail 与告警Pod相关的Kubernetes事件
+type EventDetail struct {
+	PodName string
+	Type    string
+	Reason  string
+	Message string
+	Count   int32
+	Time    time.Time
+}
+
+// ContainerDetail 发生重启的容器
+type ContainerDetail struct {
+	Name         string
+	Image        string
+	Type         string // app/init/sidecar
+	Restarts     int
+	LastExitCode int32
+	LastReason   string
+}
+
 // pod restart template
-func GetRestartMessage(cfg *config.Config, pod *v1.Pod) string {
+func GetRestartMessage(detail RestartDetail) string {
 	return fmt.Sprintf(`
-		POD: %s
+		WORKLOAD: %s
 		NAMESPACE: %s
+		LAST_POD: %s
+		RESTARTS: %d
 		RESTARTS_THRESHOLD: %d
+		CRASHLOOP_REPLICAS: %d/%d
+		CONTAINERS: %s
+		PROBABLE_CAUSE: %s
+		EVENTS: %s
 		TIMESTAMP: %s
-		MESSAGE: pod restarted times to the threshold
+		MESSAGE: %s
 		`,
-		pod.Name,
-		pod.Namespace,
-		cfg.Threshold,
-		time.Now().Format("2006-01-02 15:04:05"))
+		detail.Workload,
+		detail.Namespace,
+		detail.PodName,
+		detail.Restarts,
+		detail.Threshold,
+		detail.CrashLooping,
+		detail.Replicas,
+		formatContainers(detail.Containers),
+		detail.Cause,
+		formatEvents(detail.Events),
+		time.Now().Format("2006-01-02 15:04:05"),
+		detail.Reason)
 }
 
-func GetRollbackMessage(pod *v1.Pod, err string) string {
-	return fmt.Sprintf(`
+// 每个容器一行: name(type) image restarts exitCode reason
+func formatContainers(containers []ContainerDetail) string {
+	if len(containers) == 0 {
+		return "-"
+	}
+	lines := make([]string, 0, len(containers))
+	for _, c := range containers {
+		lines = append(lines, fmt.Sprintf("%s(%s) image=%s restarts=%d exitCode=%d reason=%s",
+			c.Name, c.Type, c.Image, c.Restarts, c.LastExitCode, c.LastReason))
+	}
+	return "\n\t\t  " + strings.Join(lines, "\n\t\t  ")
+}
+
+// RollbackDetail 回滚通知的内容
+type RollbackDetail struct {
+	Workload  string
+	Namespace string
+	PodName   string
+	Cause     string
+	Events    []EventDetail
+	Message   string
+	Diff      string // 演练模式下回滚前后的模板差异
+}
+
+func GetRollbackMessage(detail RollbackDetail) string {
+	message := fmt.Sprintf(`
+		WORKLOAD: %s
 		POD: %s
 		NAMESPACE: %s
+		PROBABLE_CAUSE: %s
+		EVENTS: %s
 		TIMESTAMP: %s
 		MESSAGE:  %s
 		`,
-		pod.Name,
-		pod.Namespace,
+		detail.Workload,
+		detail.PodName,
+		detail.Namespace,
+		detail.Cause,
+		formatEvents(detail.Events),
 		time.Now().Format("2006-01-02 15:04:05"),
-		err)
+		detail.Message)
+	if detail.Diff == "" {
+		return message
+	}
+	return message + "TEMPLATE_DIFF:\n\t\t  " + strings.ReplaceAll(detail.Diff, "\n", "\n\t\t  ") + "\n\t\t"
 }
 
-func GetFirstRestartMessage(cfg *config.Config, pod *v1.Pod) string {
+// 每个事件一行: time type reason(xcount) pod: message
+func formatEvents(events []EventDetail) string {
+	if len(events) == 0 {
+		return "-"
+	}
+	lines := make([]string, 0, len(events))
+	for _, e := range events {
+		lines = append(lines, fmt.Sprintf("%s %s %s(x%d) %s: %s",
+			e.Time.Format("15:04:05"), e.Type, e.Reason, e.Count, e.PodName, e.Message))
+	}
+	return "\n\t\t  " + strings.Join(lines, "\n\t\t  ")
+}
+
+func GetFirstRestartMessage(pod *v1.Pod, workload string, threshold int) string {
 	return fmt.Sprintf(`
+		WORKLOAD: %s
 		POD: %s
 		NAMESPACE: %s
 		TIMESTAMP: %s
 		MESSAGE:  %s
 		`,
+		workload,
 		pod.Name,
 		pod.Namespace,
 		time.Now().Format("2006-01-02 15:04:05"),
-		fmt.Sprintf("pod restarted, after times: %d rollback", cfg.Threshold))
+		fmt.Sprintf("pod restarted, after times: %d rollback", threshold))
+}
+
+// FindingDetail 检测器告警的内容，同时作为告警模板的数据
+type FindingDetail struct {
+	Detector       string
+	Severity       string
+	Workload       string
+	Namespace      string
+	Pod            string
+	Container      string
+	Detail         string
+	Count          int
+	Threshold      int
+	TimeWindow     time.Duration
+	PendingTimeout time.Duration
+	Events         []EventDetail
+}
+
+// detector finding template，MESSAGE由检测器的模板渲染
+func GetFindingMessage(detail FindingDetail, messageTemplate string) string {
+	return fmt.Sprintf(`
+		DETECTOR: %s
+		SEVERITY: %s
+		WORKLOAD: %s
+		NAMESPACE: %s
+		POD: %s
+		CONTAINER: %s
+		COUNT: %d/%d
+		EVENTS: %s
+		TIMESTAMP: %s
+		MESSAGE: %s
+		`,
+		detail.Detector,
+		detail.Severity,
+		detail.Workload,
+		detail.Namespace,
+		detail.Pod,
+		detail.Container,
+		detail.Count,
+		detail.Threshold,
+		formatEvents(detail.Events),
+		time.Now().Format("2006-01-02 15:04:05"),
+		renderTemplate(messageTemplate, detail))
+}
+
+// 渲染告警模板，模板有误时退回到原始详情
+func renderTemplate(text string, data FindingDetail) string {
+	tmpl, err := template.New(data.Detector).Parse(text)
+	if err != nil {
+		logrus.WithField("detector", data.Detector).WithError(err).Warn("Invalid message template")
+		return data.Detail
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		logrus.WithField("detector", data.Detector).WithError(err).Warn("Failed to render message template")
+		return data.Detail
+	}
+	return buf.String()
 }